@@ -19,6 +19,11 @@ var (
 	ErrEmptyURL          = errors.New("empty url")
 	ErrInvalidRequestURI = errors.New("invalid URI for request")
 	ErrHexadeciamlEscape = errors.New("hexadecimal escape in host")
+	ErrMissingBracket    = errors.New("missing ']' in host")
+	ErrInvalidPort       = errors.New("invalid port after host")
+	ErrInvalidIPLiteral  = errors.New("invalid IP literal in host")
+	ErrTooManyColons     = errors.New("too many colons in host")
+	ErrControlCharacter  = errors.New("invalid control character in URL")
 )
 
 // Constants for URL
@@ -36,17 +41,81 @@ var (
 	EqualByte        = []byte("=")
 	DotByte          = []byte(".")
 	DoubleDotByte    = []byte("..")
+	ZoneByte         = []byte("%25")
 )
 
+// Component identifies the part of a URL in which parsing failed.
+type Component int
+
+// URL components, in the order they appear in a URL.
+const (
+	ComponentScheme Component = 1 + iota
+	ComponentUserinfo
+	ComponentHost
+	ComponentPort
+	ComponentPath
+	ComponentQuery
+	ComponentFragment
+)
+
+var componentNames = [...]string{
+	ComponentScheme:   "scheme",
+	ComponentUserinfo: "userinfo",
+	ComponentHost:     "host",
+	ComponentPort:     "port",
+	ComponentPath:     "path",
+	ComponentQuery:    "query",
+	ComponentFragment: "fragment",
+}
+
+func (c Component) String() string {
+	if c <= 0 || int(c) >= len(componentNames) {
+		return "component(" + strconv.Itoa(int(c)) + ")"
+	}
+	return componentNames[c]
+}
+
 // Error reports an error and the operation and URL that caused it.
+// Component and Offset locate the failure: Offset is the index of the
+// offending byte in URL, or of the start of Component when the error
+// concerns the component as a whole.
 type Error struct {
-	Op  string
-	URL string
-	Err error
+	Op        string
+	URL       string
+	Err       error
+	Component Component
+	Offset    int
 }
 
 func (e *Error) Error() string { return e.Op + " " + e.URL + ": " + e.Err.Error() }
 
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error { return e.Err }
+
+// errorAt records that err occurred at offset in component c. Offsets
+// are relative to the slice being parsed, so callers parsing an
+// enclosing slice pass the result through errorAt again with the
+// offset of that slice, which shifts an existing *Error instead of
+// wrapping it. The offset of an EscapeError is added to offset.
+func errorAt(c Component, offset int, err error) error {
+	switch e := err.(type) {
+	case *Error:
+		e.Offset += offset
+		return e
+	case EscapeError:
+		offset += e.Offset
+	}
+	return &Error{Err: err, Component: c, Offset: offset}
+}
+
+// parseError completes err, as returned by errorAt, with the operation
+// and the URL that was parsed.
+func parseError(rawurl []byte, err error) error {
+	e := err.(*Error)
+	e.Op, e.URL = "parse", string(rawurl)
+	return e
+}
+
 func ishex(c byte) bool {
 	switch {
 	case '0' <= c && c <= '9':
@@ -71,169 +140,387 @@ func unhex(c byte) byte {
 	return 0
 }
 
-type encoding int
+// Encoding selects the URL component whose escaping rules apply.
+type Encoding int
 
+// Escaping modes, one per URL component. EncodePath keeps the slashes
+// of a whole path while EncodePathSegment escapes them. EncodeQueryComponent
+// writes spaces as '+'. EncodeZone is an IPv6 zone identifier (RFC 6874).
 const (
-	encodePath encoding = 1 + iota
-	encodeUserPassword
-	encodeQueryComponent
-	encodeFragment
+	EncodePath Encoding = 1 + iota
+	EncodePathSegment
+	EncodeUserPassword
+	EncodeQueryComponent
+	EncodeFragment
+	EncodeHost
+	EncodeZone
 )
 
-// EscapeError -
-type EscapeError string
+// EscapeError reports a malformed or disallowed percent-encoding.
+type EscapeError struct {
+	Escape string // the offending sequence, such as "%zz"
+	Offset int    // byte offset of the '%' in the escaped input
+}
 
 func (e EscapeError) Error() string {
-	return "invalid URL escape " + strconv.Quote(string(e))
+	return "invalid URL escape " + strconv.Quote(e.Escape)
 }
 
 // Return true if the specified character should be escaped when
 // appearing in a URL string, according to RFC 3986.
-func shouldEscape(c byte, mode encoding) bool {
-	// §2.3 Unreserved characters (alphanum)
-	if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' {
-		return false
-	}
-
-	switch c {
-	case '-', '_', '.', '~': // §2.3 Unreserved characters (mark)
-		return false
-
-	case '$', '&', '+', ',', '/', ':', ';', '=', '?', '@': // §2.2 Reserved characters (reserved)
-		// Different sections of the URL allow a few of
-		// the reserved characters to appear unescaped.
-		switch mode {
-		case encodePath: // §3.3
-			// The RFC allows : @ & = + $ but saves / ; , for assigning
-			// meaning to individual path segments. This package
-			// only manipulates the path as a whole, so we allow those
-			// last two as well. That leaves only ? to escape.
-			return c == '?'
-
-		case encodeUserPassword: // §3.2.1
-			// The RFC allows ';', ':', '&', '=', '+', '$', and ',' in
-			// userinfo, so we must escape only '@', '/', and '?'.
-			// The parsing of userinfo treats ':' as special so we must escape
-			// that too.
-			return c == '@' || c == '/' || c == '?' || c == ':'
-
-		case encodeQueryComponent: // §3.4
-			// The RFC reserves (so we must escape) everything.
-			return true
-
-		case encodeFragment: // §4.1
-			// The RFC text is silent but the grammar allows
-			// everything, so escape nothing.
-			return false
-		}
-	}
-
-	// Everything else must be escaped.
-	return true
+func shouldEscape(c byte, mode Encoding) bool {
+	return mode.EncodeSet().Contains(c)
 }
 
 // QueryUnescape does the inverse transformation of QueryEscape, converting
 // %AB into the byte 0xAB and '+' into ' ' (space). It returns an error if
 // any % is not followed by two hexadecimal digits.
 func QueryUnescape(s []byte) ([]byte, error) {
-	return unescape(s, encodeQueryComponent)
+	return unescape(s, EncodeQueryComponent)
 }
 
-// unescape unescapes a string; the mode specifies
-// which section of the URL string is being unescaped.
-func unescape(s []byte, mode encoding) ([]byte, error) {
-	// Count %, check that they're well-formed.
-	n := 0
+// PathUnescape does the inverse transformation of PathEscape and
+// PathSegmentEscape, converting %AB into the byte 0xAB. It returns an
+// error if any % is not followed by two hexadecimal digits.
+//
+// PathUnescape is identical to QueryUnescape except that it does not
+// unescape '+' to ' ' (space).
+func PathUnescape(s []byte) ([]byte, error) {
+	return unescape(s, EncodePathSegment)
+}
+
+// NormalizePercentEncoding applies the percent-encoding normalization
+// of RFC 3986 §6.2.2.2 to b, a raw, still encoded component such as
+// RawQuery or the result of EscapedPath: the hex digits of escapes are
+// upper-cased and escapes of unreserved characters are decoded, so
+// "%7euser", "%7Euser" and "~user" all become "~user". Other escapes
+// are kept, as decoding them could change the meaning of the component.
+// mode selects the component, whose escapes are checked as by unescape.
+// b itself is returned when it is already normalized.
+func NormalizePercentEncoding(b []byte, mode Encoding) ([]byte, error) {
+	if _, _, err := countEscapes(b, mode); err != nil {
+		return EmptyByte, err
+	}
+	i := 0
+	for ; i < len(b); i++ {
+		if b[i] == '%' {
+			if v := unhex(b[i+1])<<4 | unhex(b[i+2]); isUnreserved(v) || !isUpperHex(b[i+1]) || !isUpperHex(b[i+2]) {
+				break
+			}
+			i += 2
+		}
+	}
+	if i == len(b) {
+		return b, nil
+	}
+	t := append(make([]byte, 0, len(b)), b[:i]...)
+	for ; i < len(b); i++ {
+		c := b[i]
+		if c != '%' {
+			t = append(t, c)
+			continue
+		}
+		if v := unhex(b[i+1])<<4 | unhex(b[i+2]); isUnreserved(v) {
+			t = append(t, v)
+		} else {
+			t = append(t, '%', "0123456789ABCDEF"[v>>4], "0123456789ABCDEF"[v&15])
+		}
+		i += 2
+	}
+	return t, nil
+}
+
+// AppendQueryUnescape appends the QueryUnescape of s to dst and returns
+// the extended buffer. On error dst is returned unchanged.
+func AppendQueryUnescape(dst, s []byte) ([]byte, error) {
+	return appendUnescape(dst, s, EncodeQueryComponent)
+}
+
+// AppendPathUnescape appends the PathUnescape of s to dst and returns
+// the extended buffer. On error dst is returned unchanged.
+func AppendPathUnescape(dst, s []byte) ([]byte, error) {
+	return appendUnescape(dst, s, EncodePathSegment)
+}
+
+// UnescapeInPlace unescapes b according to mode, writing the result
+// over b itself: the unescaped form is never longer than the escaped
+// one. It returns the shrunken slice, which shares the array of b, and
+// leaves b unmodified on error. Use EncodePath, EncodeQueryComponent or
+// EncodeUserPassword as mode for paths, query components and userinfo.
+func UnescapeInPlace(b []byte, mode Encoding) ([]byte, error) {
+	n, hasPlus, err := countEscapes(b, mode)
+	if err != nil {
+		return EmptyByte, err
+	}
+	if n == 0 && !hasPlus {
+		return b, nil
+	}
+	// appendUnescaped never writes past the byte it is reading.
+	return appendUnescaped(b[:0], b, mode), nil
+}
+
+// QueryUnescapeLenient is like QueryUnescape, but decodes s the way
+// browsers do: a '%' that is not followed by two hexadecimal digits is
+// kept literally instead of failing the whole decoding. It returns the
+// number of such invalid sequences along with the result.
+func QueryUnescapeLenient(s []byte) ([]byte, int) {
+	return unescapeLenient(s, EncodeQueryComponent)
+}
+
+// PathUnescapeLenient is like PathUnescape, but keeps invalid escapes
+// literally, see QueryUnescapeLenient.
+func PathUnescapeLenient(s []byte) ([]byte, int) {
+	return unescapeLenient(s, EncodePathSegment)
+}
+
+// unescapeLenient is unescape, passing malformed escapes through and
+// counting them instead of failing.
+func unescapeLenient(s []byte, mode Encoding) ([]byte, int) {
+	n, invalid := 0, 0
 	hasPlus := false
-	for i := 0; i < len(s); {
+	for i := 0; i < len(s); i++ {
 		switch s[i] {
 		case '%':
-			n++
-			if i+2 >= len(s) || !ishex(s[i+1]) || !ishex(s[i+2]) {
-				s = s[i:]
-				if len(s) > 3 {
-					s = s[0:3]
-				}
-				return EmptyByte, EscapeError(s)
+			if validEscape(s, i) {
+				n++
+				i += 2
+			} else {
+				invalid++
 			}
-			i += 3
 		case '+':
-			hasPlus = mode == encodeQueryComponent
-			i++
+			hasPlus = mode == EncodeQueryComponent
+		}
+	}
+	if n == 0 && !hasPlus {
+		return s, invalid
+	}
+	t := make([]byte, 0, len(s)-2*n)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '%' && validEscape(s, i):
+			t = append(t, unhex(s[i+1])<<4|unhex(s[i+2]))
+			i += 2
+		case c == '+' && mode == EncodeQueryComponent:
+			t = append(t, ' ')
 		default:
-			i++
+			t = append(t, c)
 		}
 	}
+	return t, invalid
+}
+
+// validEscape reports whether s[i] starts a well-formed escape.
+func validEscape(s []byte, i int) bool {
+	return i+2 < len(s) && ishex(s[i+1]) && ishex(s[i+2])
+}
 
+// unescape unescapes a string; the mode specifies
+// which section of the URL string is being unescaped.
+func unescape(s []byte, mode Encoding) ([]byte, error) {
+	n, hasPlus, err := countEscapes(s, mode)
+	if err != nil {
+		return EmptyByte, err
+	}
 	if n == 0 && !hasPlus {
 		return s, nil
 	}
+	return appendUnescaped(make([]byte, 0, len(s)-2*n), s, mode), nil
+}
 
-	t := make([]byte, len(s)-2*n)
-	j := 0
+func appendUnescape(dst, s []byte, mode Encoding) ([]byte, error) {
+	n, _, err := countEscapes(s, mode)
+	if err != nil {
+		return dst, err
+	}
+	return appendUnescaped(grow(dst, len(s)-2*n), s, mode), nil
+}
+
+// countEscapes counts the escapes in s and checks that they are
+// well-formed. hasPlus reports whether a '+' needs to be decoded.
+func countEscapes(s []byte, mode Encoding) (n int, hasPlus bool, err error) {
+	plus := mode == EncodeQueryComponent
 	for i := 0; i < len(s); {
+		j := indexEscape(s[i:], plus)
+		if j < 0 {
+			break
+		}
+		i += j
 		switch s[i] {
 		case '%':
-			t[j] = unhex(s[i+1])<<4 | unhex(s[i+2])
-			j++
-			i += 3
-		case '+':
-			if mode == encodeQueryComponent {
-				t[j] = ' '
-			} else {
-				t[j] = '+'
+			n++
+			if i+2 >= len(s) || !ishex(s[i+1]) || !ishex(s[i+2]) {
+				s = s[i:]
+				if len(s) > 3 {
+					s = s[0:3]
+				}
+				return 0, false, EscapeError{string(s), i}
 			}
-			j++
-			i++
-		default:
-			t[j] = s[i]
-			j++
+			if mode == EncodeZone {
+				// RFC 6874 allows escaping in zone identifiers, but only
+				// of bytes that could have been written directly, with
+				// the exception of spaces used by Windows interface names.
+				v := unhex(s[i+1])<<4 | unhex(s[i+2])
+				if !bytes.Equal(s[i:i+3], ZoneByte) && v != ' ' && shouldEscape(v, EncodeHost) {
+					return 0, false, EscapeError{string(s[i : i+3]), i}
+				}
+			}
+			i += 3
+		default: // '+'
+			hasPlus = true
 			i++
 		}
 	}
-	return t, nil
+	return n, hasPlus, nil
+}
+
+// appendUnescaped appends the unescaping of s, whose escapes have been
+// checked by countEscapes, to dst.
+func appendUnescaped(dst, s []byte, mode Encoding) []byte {
+	plus := mode == EncodeQueryComponent
+	for {
+		i := indexEscape(s, plus)
+		if i < 0 {
+			return append(dst, s...)
+		}
+		dst = append(dst, s[:i]...)
+		if s[i] == '+' {
+			dst = append(dst, ' ')
+			s = s[i+1:]
+		} else {
+			dst = append(dst, unhex(s[i+1])<<4|unhex(s[i+2]))
+			s = s[i+3:]
+		}
+	}
 }
 
 // QueryEscape escapes the string so it can be safely placed
 // inside a URL query.
 func QueryEscape(b []byte) []byte {
-	return escape(b, encodeQueryComponent)
+	return escape(b, EncodeQueryComponent)
 }
 
-func escape(s []byte, mode encoding) []byte {
-	spaceCount, hexCount := 0, 0
-	for i := 0; i < len(s); i++ {
-		c := s[i]
-		if shouldEscape(c, mode) {
-			if c == ' ' && mode == encodeQueryComponent {
-				spaceCount++
-			} else {
-				hexCount++
-			}
-		}
-	}
+// PathEscape escapes the string so it can be safely placed inside a
+// URL path. Slashes are kept, so the result is the path as a whole;
+// use PathSegmentEscape to escape a single segment.
+func PathEscape(b []byte) []byte {
+	return escape(b, EncodePath)
+}
 
+// PathSegmentEscape escapes the string so it can be safely placed
+// inside a single URL path segment, replacing special characters
+// (including /) with %XX sequences as needed. It matches PathEscape
+// of net/url.
+func PathSegmentEscape(b []byte) []byte {
+	return escape(b, EncodePathSegment)
+}
+
+// AppendQueryEscape appends the QueryEscape of s to dst and returns
+// the extended buffer.
+func AppendQueryEscape(dst, s []byte) []byte {
+	return appendEscape(dst, s, EncodeQueryComponent)
+}
+
+// AppendPathEscape appends the PathEscape of s to dst and returns the
+// extended buffer.
+func AppendPathEscape(dst, s []byte) []byte {
+	return appendEscape(dst, s, EncodePath)
+}
+
+// AppendPathSegmentEscape appends the PathSegmentEscape of s to dst and
+// returns the extended buffer.
+func AppendPathSegmentEscape(dst, s []byte) []byte {
+	return appendEscape(dst, s, EncodePathSegment)
+}
+
+func escape(s []byte, mode Encoding) []byte {
+	set, plus := mode.EncodeSet(), mode == EncodeQueryComponent
+	spaceCount, hexCount := countShouldEscape(s, &set, plus)
 	if spaceCount == 0 && hexCount == 0 {
 		return s
 	}
+	return appendEscaped(make([]byte, 0, len(s)+2*hexCount), s, &set, plus)
+}
 
-	t := make([]byte, len(s)+2*hexCount)
-	j := 0
-	for i := 0; i < len(s); i++ {
-		switch c := s[i]; {
-		case c == ' ' && mode == encodeQueryComponent:
-			t[j] = '+'
-			j++
-		case shouldEscape(c, mode):
-			t[j] = '%'
-			t[j+1] = "0123456789ABCDEF"[c>>4]
-			t[j+2] = "0123456789ABCDEF"[c&15]
-			j += 3
-		default:
-			t[j] = s[i]
-			j++
+// EscapedLen returns the length of the escaping of src in mode, such
+// as len(QueryEscape(src)) for EncodeQueryComponent, without building it.
+func EscapedLen(src []byte, mode Encoding) int {
+	set := mode.EncodeSet()
+	_, hexCount := countShouldEscape(src, &set, mode == EncodeQueryComponent)
+	return len(src) + 2*hexCount
+}
+
+func appendEscape(dst, s []byte, mode Encoding) []byte {
+	set, plus := mode.EncodeSet(), mode == EncodeQueryComponent
+	_, hexCount := countShouldEscape(s, &set, plus)
+	return appendEscaped(grow(dst, len(s)+2*hexCount), s, &set, plus)
+}
+
+// countShouldEscape counts the bytes of s that escaping with set
+// replaces: spaces written as '+' if plus is set and bytes written as %XX.
+func countShouldEscape(s []byte, set *EncodeSet, plus bool) (spaceCount, hexCount int) {
+	fast := set.keepsUnreserved()
+	for i := 0; i < len(s); {
+		if fast && i+8 <= len(s) && isUnreservedWord(load(s[i:])) {
+			i += 8
+			continue
+		}
+		end := len(s)
+		if fast && i+8 < end {
+			end = i + 8
+		}
+		for ; i < end; i++ {
+			c := s[i]
+			if set.Contains(c) {
+				if c == ' ' && plus {
+					spaceCount++
+				} else {
+					hexCount++
+				}
+			}
+		}
+	}
+	return
+}
+
+// appendEscaped appends the escaping of s with set to dst, writing
+// spaces as '+' if plus is set.
+func appendEscaped(dst, s []byte, set *EncodeSet, plus bool) []byte {
+	fast := set.keepsUnreserved()
+	run := 0 // start of the bytes kept as is, not yet appended
+	for i := 0; i < len(s); {
+		if fast && i+8 <= len(s) && isUnreservedWord(load(s[i:])) {
+			i += 8
+			continue
+		}
+		end := len(s)
+		if fast && i+8 < end {
+			end = i + 8
+		}
+		for ; i < end; i++ {
+			c := s[i]
+			if !set.Contains(c) && (c != ' ' || !plus) {
+				continue
+			}
+			dst = append(dst, s[run:i]...)
+			run = i + 1
+			if c == ' ' && plus {
+				dst = append(dst, '+')
+			} else {
+				dst = append(dst, '%', "0123456789ABCDEF"[c>>4], "0123456789ABCDEF"[c&15])
+			}
 		}
 	}
+	return append(dst, s[run:]...)
+}
+
+// grow makes room for n more bytes in dst, so appending them
+// allocates at most once.
+func grow(dst []byte, n int) []byte {
+	if cap(dst)-len(dst) >= n {
+		return dst
+	}
+	t := make([]byte, len(dst), 2*cap(dst)+n)
+	copy(t, dst)
 	return t
 }
 
@@ -249,18 +536,47 @@ func escape(s []byte, mode encoding) []byte {
 // Note that the Path field is stored in decoded form: /%47%6f%2f becomes /Go/.
 // A consequence is that it is impossible to tell which slashes in the Path were
 // slashes in the raw URL and which were %2f. This distinction is rarely important,
-// but when it is a client must use other routines to parse the raw URL or construct
-// the parsed URL. For example, an HTTP server can consult req.RequestURI, and
-// an HTTP client can use URL{Host: "example.com", Opaque: "//example.com/Go%2f"}
-// instead of URL{Host: "example.com", Path: "/Go/"}.
+// but when it is, the code should use the EscapedPath method, which preserves
+// the original encoding of Path.
+//
+// The RawPath field is an optional field which is only set when the default
+// encoding of Path is different from the escaped path. See the EscapedPath
+// method for more details. RawFragment plays the same role for Fragment,
+// see the EscapedFragment method, and RawHost for Host, see EscapedHost.
 type URL struct {
-	Scheme   []byte
-	Opaque   []byte    // encoded opaque data
-	User     *Userinfo // username and password information
-	Host     []byte    // host or host:port
-	Path     []byte
-	RawQuery []byte // encoded query values, without '?'
-	Fragment []byte // fragment for references, without '#'
+	Scheme        []byte
+	Opaque        []byte    // encoded opaque data
+	User          *Userinfo // username and password information
+	Host          []byte    // host or host:port
+	RawHost       []byte    // encoded host hint (see EscapedHost method)
+	Path          []byte    // path (relative paths may omit leading slash)
+	RawPath       []byte    // encoded path hint (see EscapedPath method)
+	OmitHost      bool      // do not emit empty host (authority)
+	ForceHost     bool      // emit empty host (authority) even if Path is empty
+	ForceQuery    bool      // append a query ('?') even if RawQuery is empty
+	RawQuery      []byte    // encoded query values, without '?'
+	Fragment      []byte    // fragment for references, without '#'
+	RawFragment   []byte    // encoded fragment hint (see EscapedFragment method)
+	ForceFragment bool      // append a fragment ('#') even if Fragment is empty
+
+	// InvalidEscapes is the number of '%' that did not start a valid
+	// escape and were kept literally when parsing with
+	// ParseOptions.Lenient. It is zero otherwise.
+	InvalidEscapes int
+
+	// userinfo is the storage User points at after parsing, so that
+	// reusing a URL with ParseInto does not allocate a new Userinfo.
+	userinfo Userinfo
+
+	// pending lists the components left escaped by ParseOptions.InPlace
+	// until the whole URL has parsed, see unescapePending.
+	pending uint8
+}
+
+// Reset clears all fields of u so it can be reused with ParseInto.
+// The slices previously referenced by u are released, not cleared.
+func (u *URL) Reset() {
+	*u = URL{}
 }
 
 // Maybe rawurl is of the form scheme:path.
@@ -290,6 +606,49 @@ func getscheme(rawurl []byte) (scheme, path []byte, err error) {
 	return EmptyByte, rawurl, nil
 }
 
+// validateControl rejects ASCII control bytes and DEL anywhere in
+// rawurl: a CR or LF surviving into RequestURI could split the request
+// line of an HTTP request.
+func validateControl(rawurl []byte) error {
+	for i, c := range rawurl {
+		if c < ' ' || c == 0x7f {
+			return errorAt(componentAt(rawurl, i), i, ErrControlCharacter)
+		}
+	}
+	return nil
+}
+
+// componentAt returns the component of rawurl holding the byte at
+// offset i, splitting rawurl the way parse does.
+func componentAt(rawurl []byte, i int) Component {
+	if j := bytes.IndexByte(rawurl, '#'); j >= 0 && j < i {
+		return ComponentFragment
+	}
+	if j := bytes.IndexByte(rawurl, '?'); j >= 0 && j < i {
+		return ComponentQuery
+	}
+	_, rest, err := getscheme(rawurl)
+	if err != nil {
+		return ComponentScheme
+	}
+	off := len(rawurl) - len(rest)
+	if !bytes.HasPrefix(rest, DoubleSlash) || i < off+2 {
+		return ComponentPath
+	}
+	authority := rest[2:]
+	if j := bytes.IndexAny(authority, "/?#"); j >= 0 {
+		authority = authority[:j]
+	}
+	i -= off + 2
+	switch {
+	case i >= len(authority):
+		return ComponentPath
+	case i < bytes.LastIndexByte(authority, '@'):
+		return ComponentUserinfo
+	}
+	return ComponentHost
+}
+
 // Maybe s is of the form t c u.
 // If so, return t, c u (or t, u if cutc == true).
 // If not, return s, "".
@@ -305,20 +664,27 @@ func split(s, c []byte, cutc bool) ([]byte, []byte) {
 }
 
 // Parse parses rawurl into a URL structure.
-// The rawurl may be relative or absolute.
+// The rawurl may be relative or absolute. ASCII control characters
+// are rejected with ErrControlCharacter.
 func Parse(rawurl []byte) (url *URL, err error) {
-	// Cut off #frag
-	u, frag := split(rawurl, FragmentByte, true)
-	if url, err = parse(u, false); err != nil {
-		return nil, err
-	}
-	if bytes.Equal(frag, EmptyByte) {
-		return url, nil
-	}
-	if url.Fragment, err = unescape(frag, encodeFragment); err != nil {
-		return nil, &Error{"parse", string(rawurl), err}
-	}
-	return url, nil
+	return ParseOptions{}.Parse(rawurl)
+}
+
+// ParseInto is like Parse but stores the result in dst instead of
+// allocating a new URL. dst is reset first; a Userinfo set up by a
+// previous ParseInto on dst is overwritten rather than reallocated.
+//
+// The fields of dst are sub-slices of rawurl wherever no unescaping
+// is needed, so rawurl must not be modified while dst is in use.
+// Parsing an URL without escapes does not allocate.
+//
+// dst.User points into dst itself. A copy made with v := *dst shares
+// that Userinfo, so the next ParseInto on dst changes v.User as well;
+// if v must outlive the reuse of dst, give it its own Userinfo with
+// ui := *v.User; v.User = &ui. The URL returned by ResolveReference
+// does not share the Userinfo of its receiver or argument.
+func ParseInto(dst *URL, rawurl []byte) error {
+	return ParseOptions{}.ParseInto(dst, rawurl)
 }
 
 // ParseRequestURI parses rawurl into a URL structure.  It assumes that
@@ -326,22 +692,25 @@ func Parse(rawurl []byte) (url *URL, err error) {
 // only as an absolute URI or an absolute path.
 // The string rawurl is assumed not to have a #fragment suffix.
 // (Web browsers strip #fragment before sending the URL to a web server.)
+// As with Parse, ASCII control characters are rejected.
 func ParseRequestURI(rawurl []byte) (url *URL, err error) {
-	return parse(rawurl, true)
+	return ParseOptions{}.ParseRequestURI(rawurl)
 }
 
 // parse parses a URL from a string in one of two contexts.  If
 // viaRequest is true, the URL is assumed to have arrived via an HTTP request,
 // in which case only absolute URLs or path-absolute relative URLs are allowed.
 // If viaRequest is false, all forms of relative URLs are allowed.
-func parse(rawurl []byte, viaRequest bool) (url *URL, err error) {
+// The result is stored in url, which is reset first.
+func (o *ParseOptions) parse(url *URL, rawurl []byte, viaRequest bool) (err error) {
 	var rest []byte
+	var off int // offset of rest in rawurl
 
+	url.Reset()
 	if bytes.Equal(rawurl, EmptyByte) && viaRequest {
-		err = ErrEmptyURL
+		err = errorAt(ComponentPath, 0, ErrEmptyURL)
 		goto Error
 	}
-	url = new(URL)
 
 	if bytes.Equal(rawurl, AsteriskByte) {
 		url.Path = AsteriskByte
@@ -351,20 +720,27 @@ func parse(rawurl []byte, viaRequest bool) (url *URL, err error) {
 	// Split off possible leading "http:", "mailto:", etc.
 	// Cannot contain escaped characters.
 	if url.Scheme, rest, err = getscheme(rawurl); err != nil {
+		err = errorAt(ComponentScheme, 0, err)
 		goto Error
 	}
-	url.Scheme = bytes.ToLower(url.Scheme)
+	url.Scheme = lower(url.Scheme)
+	off = len(rawurl) - len(rest)
 
-	rest, url.RawQuery = split(rest, QuestionMarkByte, true)
+	if bytes.HasSuffix(rest, QuestionMarkByte) && bytes.IndexByte(rest, '?') == len(rest)-1 {
+		url.ForceQuery = true
+		rest = rest[:len(rest)-1]
+	} else {
+		rest, url.RawQuery = split(rest, QuestionMarkByte, true)
+	}
 
 	if !bytes.HasPrefix(rest, SlashByte) {
 		if bytes.Compare(url.Scheme, EmptyByte) != 0 {
 			// We consider rootless paths per RFC 3986 as opaque.
 			url.Opaque = rest
-			return url, nil
+			return nil
 		}
 		if viaRequest {
-			err = ErrInvalidRequestURI
+			err = errorAt(ComponentPath, off, ErrInvalidRequestURI)
 			goto Error
 		}
 	}
@@ -372,49 +748,341 @@ func parse(rawurl []byte, viaRequest bool) (url *URL, err error) {
 	if (bytes.Compare(url.Scheme, EmptyByte) != 0 || !viaRequest && !bytes.HasPrefix(rest, TripleSlash)) && bytes.HasPrefix(rest, DoubleSlash) {
 		var authority []byte
 		authority, rest = split(rest[2:], SlashByte, false)
-		url.User, url.Host, err = parseAuthority(authority)
+		off += 2
+		url.User, url.Host, err = url.parseAuthority(authority, o)
 		if err != nil {
+			err = errorAt(ComponentUserinfo, off, err)
 			goto Error
 		}
-		if bytes.Contains(url.Host, PercentByte) {
-			err = ErrHexadeciamlEscape
-			goto Error
+		// An empty authority, as in "foo://", is written back even
+		// when there is no path to keep its "//".
+		url.ForceHost = len(authority) == 0
+		if o.IDNA {
+			if url.Host, err = hostToASCII(url.Host); err != nil {
+				err = errorAt(ComponentHost, off+bytes.LastIndex(authority, EtaByte)+1, err)
+				goto Error
+			}
 		}
+		off += len(authority)
+	} else if bytes.Compare(url.Scheme, EmptyByte) != 0 && bytes.HasPrefix(rest, SlashByte) {
+		// OmitHost is set when rawurl has no authority at all, as in
+		// "file:/etc", so the path is written back without "//". An
+		// empty authority, as in "file:///etc", keeps its "//".
+		url.OmitHost = true
 	}
-	if url.Path, err = unescape(rest, encodePath); err != nil {
+	if err = url.setPath(rest, o); err != nil {
+		err = errorAt(ComponentPath, off, err)
 		goto Error
 	}
-	return url, nil
+	return nil
 
 Error:
-	return nil, &Error{"parse", string(rawurl), err}
+	return parseError(rawurl, err)
 }
 
-func parseAuthority(authority []byte) (user *Userinfo, host []byte, err error) {
+// lower returns b with ASCII letters mapped to lower case. Unlike
+// bytes.ToLower it returns b itself when it is already lower case.
+func lower(b []byte) []byte {
+	for _, c := range b {
+		if 'A' <= c && c <= 'Z' {
+			return bytes.ToLower(b)
+		}
+	}
+	return b
+}
+
+// parseAuthority splits authority into userinfo and host. When the
+// authority carries userinfo it is stored in u.userinfo, which is
+// returned as user. Errors are located relative to authority, see
+// errorAt. Userinfo is unescaped as o.unescape does.
+func (u *URL) parseAuthority(authority []byte, o *ParseOptions) (user *Userinfo, host []byte, err error) {
 	i := bytes.LastIndex(authority, EtaByte)
 	if i < 0 {
-		host = authority
+		if host, err = parseHost(authority); err != nil {
+			err = errorAt(ComponentHost, 0, err)
+		}
 		return
 	}
 	userinfo, host := authority[:i], authority[i+1:]
+	if host, err = parseHost(host); err != nil {
+		err = errorAt(ComponentHost, i+1, err)
+		return
+	}
 	if bytes.Index(userinfo, ColonByte) < 0 {
-		if userinfo, err = unescape(userinfo, encodeUserPassword); err != nil {
+		if userinfo, err = o.unescape(u, userinfo, EncodeUserPassword, pendingUsername); err != nil {
+			err = errorAt(ComponentUserinfo, 0, err)
 			return
 		}
-		user = User(userinfo)
+		u.userinfo = Userinfo{userinfo, EmptyByte, false}
 	} else {
 		username, password := split(userinfo, ColonByte, true)
-		if username, err = unescape(username, encodeUserPassword); err != nil {
+		colon := len(username)
+		if username, err = o.unescape(u, username, EncodeUserPassword, pendingUsername); err != nil {
+			err = errorAt(ComponentUserinfo, 0, err)
 			return
 		}
-		if password, err = unescape(password, encodeUserPassword); err != nil {
+		if password, err = o.unescape(u, password, EncodeUserPassword, pendingPassword); err != nil {
+			err = errorAt(ComponentUserinfo, colon+1, err)
 			return
 		}
-		user = UserPassword(username, password)
+		u.userinfo = Userinfo{username, password, true}
 	}
+	user = &u.userinfo
 	return
 }
 
+// setPath sets the Path and RawPath fields of the URL based on the provided
+// escaped path p. It maintains the invariant that RawPath is only specified
+// when it differs from the default encoding of the path.
+// For example:
+// - setPath("/foo/bar")   will set Path="/foo/bar" and RawPath=""
+// - setPath("/foo%2fbar") will set Path="/foo/bar" and RawPath="/foo%2fbar"
+// setPath will return an error only if the provided path contains an invalid
+// escaping. p is unescaped as o.unescape does, in place only if RawPath
+// is not needed; o may be nil.
+func (u *URL) setPath(p []byte, o *ParseOptions) error {
+	def := defaultEncoded(p, EncodePath)
+	var pending uint8
+	if def {
+		pending = pendingPath
+	}
+	path, err := o.unescape(u, p, EncodePath, pending)
+	if err != nil {
+		return err
+	}
+	u.Path = path
+	if def {
+		// Default encoding is fine.
+		u.RawPath = EmptyByte
+	} else {
+		u.RawPath = p
+	}
+	return nil
+}
+
+// EscapedPath returns the escaped form of u.Path.
+// In general there are multiple possible escaped forms of any path.
+// EscapedPath returns u.RawPath when it is a valid escaping of u.Path.
+// Otherwise EscapedPath ignores u.RawPath and computes an escaped
+// form on its own.
+// The Bytes and RequestURI methods use EscapedPath to construct
+// their results.
+// In general, code should call EscapedPath instead of
+// reading u.RawPath directly.
+func (u *URL) EscapedPath() []byte {
+	if u.useRawPath() {
+		return u.RawPath
+	}
+	if bytes.Equal(u.Path, AsteriskByte) {
+		return AsteriskByte // don't escape (Issue 11202)
+	}
+	return escape(u.Path, EncodePath)
+}
+
+// useRawPath reports whether EscapedPath returns u.RawPath. A RawPath
+// with invalid escapes is kept if Path was decoded from it leniently.
+func (u *URL) useRawPath() bool {
+	return len(u.RawPath) > 0 && validEncoded(u.RawPath, EncodePath) &&
+		unescapesTo(u.RawPath, u.Path, EncodePath)
+}
+
+// escapedPathLen returns len(u.EscapedPath()).
+func (u *URL) escapedPathLen() int {
+	if u.useRawPath() {
+		return len(u.RawPath)
+	}
+	if bytes.Equal(u.Path, AsteriskByte) {
+		return len(AsteriskByte)
+	}
+	return EscapedLen(u.Path, EncodePath)
+}
+
+// pathHasSlash reports whether u.EscapedPath() starts with '/'. It
+// does exactly when u.Path does, as '/' is never escaped in a path.
+func (u *URL) pathHasSlash() bool {
+	if u.useRawPath() {
+		return u.RawPath[0] == '/'
+	}
+	return len(u.Path) > 0 && u.Path[0] == '/'
+}
+
+// appendEscapedPath appends u.EscapedPath() to dst.
+func (u *URL) appendEscapedPath(dst []byte) []byte {
+	if u.useRawPath() {
+		return append(dst, u.RawPath...)
+	}
+	if bytes.Equal(u.Path, AsteriskByte) {
+		return append(dst, AsteriskByte...)
+	}
+	return appendEscape(dst, u.Path, EncodePath)
+}
+
+// setFragment is like setPath but for Fragment/RawFragment.
+func (u *URL) setFragment(f []byte, o *ParseOptions) error {
+	def := defaultEncoded(f, EncodeFragment)
+	var pending uint8
+	if def {
+		pending = pendingFragment
+	}
+	frag, err := o.unescape(u, f, EncodeFragment, pending)
+	if err != nil {
+		return err
+	}
+	u.Fragment = frag
+	if def {
+		// Default encoding is fine.
+		u.RawFragment = EmptyByte
+	} else {
+		u.RawFragment = f
+	}
+	return nil
+}
+
+// EscapedFragment returns the escaped form of u.Fragment.
+// In general there are multiple possible escaped forms of any fragment.
+// EscapedFragment returns u.RawFragment when it is a valid escaping of u.Fragment.
+// Otherwise EscapedFragment ignores u.RawFragment and computes an escaped
+// form on its own.
+// The Bytes method uses EscapedFragment to construct its result.
+// In general, code should call EscapedFragment instead of
+// reading u.RawFragment directly.
+func (u *URL) EscapedFragment() []byte {
+	if u.useRawFragment() {
+		return u.RawFragment
+	}
+	return escape(u.Fragment, EncodeFragment)
+}
+
+// useRawFragment reports whether EscapedFragment returns u.RawFragment.
+func (u *URL) useRawFragment() bool {
+	return len(u.RawFragment) > 0 && validEncoded(u.RawFragment, EncodeFragment) &&
+		unescapesTo(u.RawFragment, u.Fragment, EncodeFragment)
+}
+
+// escapedFragmentLen returns len(u.EscapedFragment()).
+func (u *URL) escapedFragmentLen() int {
+	if u.useRawFragment() {
+		return len(u.RawFragment)
+	}
+	return EscapedLen(u.Fragment, EncodeFragment)
+}
+
+// appendEscapedFragment appends u.EscapedFragment() to dst.
+func (u *URL) appendEscapedFragment(dst []byte) []byte {
+	if u.useRawFragment() {
+		return append(dst, u.RawFragment...)
+	}
+	return appendEscape(dst, u.Fragment, EncodeFragment)
+}
+
+// EscapedHost returns the escaped form of u.Host. It returns
+// u.RawHost when it is a valid escaping of u.Host, which keeps the
+// percent-encoding of the opaque hosts of ParseWHATWG; otherwise it
+// escapes u.Host as escapeHost does.
+func (u *URL) EscapedHost() []byte {
+	if u.useRawHost() {
+		return u.RawHost
+	}
+	return escapeHost(u.Host)
+}
+
+// useRawHost reports whether EscapedHost returns u.RawHost.
+func (u *URL) useRawHost() bool {
+	return len(u.RawHost) > 0 && validEncoded(u.RawHost, EncodeHost) &&
+		unescapesTo(u.RawHost, u.Host, EncodeHost)
+}
+
+// escapedHostLen returns len(u.EscapedHost()).
+func (u *URL) escapedHostLen() int {
+	if u.useRawHost() {
+		return len(u.RawHost)
+	}
+	return escapeHostLen(u.Host)
+}
+
+// appendEscapedHost appends u.EscapedHost() to dst.
+func (u *URL) appendEscapedHost(dst []byte) []byte {
+	if u.useRawHost() {
+		return append(dst, u.RawHost...)
+	}
+	return appendEscapeHost(dst, u.Host)
+}
+
+// unescapesTo reports whether the lenient unescaping of s in mode is
+// want, without allocating.
+func unescapesTo(s, want []byte, mode Encoding) bool {
+	j := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '%' && validEscape(s, i):
+			c = unhex(s[i+1])<<4 | unhex(s[i+2])
+			i += 2
+		case c == '+' && mode == EncodeQueryComponent:
+			c = ' '
+		}
+		if j == len(want) || want[j] != c {
+			return false
+		}
+		j++
+	}
+	return j == len(want)
+}
+
+// defaultEncoded reports whether s is well-formed and equal to the
+// escaping of its unescaping in mode, in which case the escaped form
+// need not be kept. mode must not be EncodeQueryComponent.
+func defaultEncoded(s []byte, mode Encoding) bool {
+	set := mode.EncodeSet()
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '%' {
+			if set.Contains(c) {
+				return false
+			}
+			continue
+		}
+		if i+2 >= len(s) || !isUpperHex(s[i+1]) || !isUpperHex(s[i+2]) {
+			return false
+		}
+		if !set.Contains(unhex(s[i+1])<<4 | unhex(s[i+2])) {
+			return false
+		}
+		i += 2
+	}
+	return true
+}
+
+func isUpperHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'A' <= c && c <= 'F'
+}
+
+// validEncoded reports whether s is a valid encoded path or fragment,
+// according to mode.
+// It must not contain any bytes that require escaping during encoding.
+func validEncoded(s []byte, mode Encoding) bool {
+	for i := 0; i < len(s); i++ {
+		// RFC 3986, Appendix A.
+		// pchar = unreserved / pct-encoded / sub-delims / ":" / "@".
+		// shouldEscape is not quite compliant with the RFC,
+		// so we check the sub-delims ourselves and let
+		// shouldEscape handle the others.
+		switch s[i] {
+		case '!', '$', '&', '\'', '(', ')', '*', '+', ',', ';', '=', ':', '@':
+			// ok
+		case '[', ']':
+			// ok - not specified in RFC 3986 but left alone by modern browsers
+		case '%':
+			// ok - percent encoded, will decode
+		default:
+			if shouldEscape(s[i], mode) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 // Bytes reassembles the URL into a valid URL string.
 // The general form of the result is one of:
 //
@@ -430,48 +1098,97 @@ func parseAuthority(authority []byte) (user *Userinfo, host []byte, err error) {
 //	- if u.Host is empty, host/ is omitted.
 //	- if u.Scheme and u.Host are empty and u.User is nil,
 //	   the entire scheme://userinfo@host/ is omitted.
+//	- if u.OmitHost is true and u.Host is empty and u.User is nil,
+//	   the // of an empty authority is omitted.
+//	- otherwise, if u.ForceHost is true, the // of an empty authority
+//	   is written even if u.Path is empty.
 //	- if u.Host is non-empty and u.Path begins with a /,
 //	   the form host/path does not add its own /.
-//	- if u.RawQuery is empty, ?query is omitted.
-//	- if u.Fragment is empty, #fragment is omitted.
+//	- if u.RawQuery is empty, ?query is omitted
+//	   unless u.ForceQuery is true.
+//	- if u.Fragment is empty, #fragment is omitted
+//	   unless u.ForceFragment is true.
 func (u *URL) String() string {
 	return string(u.Bytes())
 }
 
 // Bytes -
 func (u *URL) Bytes() []byte {
-	var buf bytes.Buffer
-	if bytes.Compare(u.Scheme, EmptyByte) != 0 {
-		buf.Write(u.Scheme)
-		buf.WriteByte(':')
+	return u.appendBytes(make([]byte, 0, u.EncodedLen()))
+}
+
+// EncodedLen returns the length of u.Bytes(), without building it.
+func (u *URL) EncodedLen() int {
+	n := 0
+	if len(u.Scheme) > 0 {
+		n += len(u.Scheme) + 1
 	}
-	if bytes.Compare(u.Opaque, EmptyByte) != 0 {
-		buf.Write(u.Opaque)
+	if len(u.Opaque) > 0 {
+		n += len(u.Opaque)
 	} else {
-		if bytes.Compare(u.Scheme, EmptyByte) != 0 || bytes.Compare(u.Host, EmptyByte) != 0 || u.User != nil {
-			buf.Write(DoubleSlash)
-			if ui := u.User; ui != nil {
-				buf.Write(ui.Bytes())
-				buf.WriteByte('@')
+		if len(u.Scheme) > 0 || len(u.Host) > 0 || u.User != nil || u.ForceHost {
+			if !u.OmitHost || len(u.Host) > 0 || u.User != nil {
+				if len(u.Host) > 0 || len(u.Path) > 0 || u.User != nil || u.ForceHost {
+					n += len(DoubleSlash)
+				}
+				if u.User != nil {
+					n += u.User.EncodedLen() + 1
+				}
+				n += u.escapedHostLen()
 			}
-			if h := u.Host; bytes.Compare(h, EmptyByte) != 0 {
-				buf.Write(h)
+		}
+		pathLen := u.escapedPathLen()
+		if pathLen > 0 && len(u.Host) > 0 && !u.pathHasSlash() {
+			n++
+		}
+		n += pathLen
+	}
+	if u.ForceQuery || len(u.RawQuery) > 0 {
+		n += 1 + len(u.RawQuery)
+	}
+	if u.ForceFragment || len(u.Fragment) > 0 {
+		n += 1 + u.escapedFragmentLen()
+	}
+	return n
+}
+
+// appendBytes appends u.Bytes() to dst.
+func (u *URL) appendBytes(dst []byte) []byte {
+	if len(u.Scheme) > 0 {
+		dst = append(dst, u.Scheme...)
+		dst = append(dst, ':')
+	}
+	if len(u.Opaque) > 0 {
+		dst = append(dst, u.Opaque...)
+	} else {
+		if len(u.Scheme) > 0 || len(u.Host) > 0 || u.User != nil || u.ForceHost {
+			if u.OmitHost && len(u.Host) == 0 && u.User == nil {
+				// Omit empty host
+			} else {
+				if len(u.Host) > 0 || len(u.Path) > 0 || u.User != nil || u.ForceHost {
+					dst = append(dst, DoubleSlash...)
+				}
+				if ui := u.User; ui != nil {
+					dst = ui.appendBytes(dst)
+					dst = append(dst, '@')
+				}
+				dst = u.appendEscapedHost(dst)
 			}
 		}
-		if bytes.Compare(u.Path, EmptyByte) != 0 && u.Path[0] != '/' && bytes.Compare(u.Host, EmptyByte) != 0 {
-			buf.WriteByte('/')
+		if len(u.Host) > 0 && !u.pathHasSlash() && u.escapedPathLen() > 0 {
+			dst = append(dst, '/')
 		}
-		buf.Write(escape(u.Path, encodePath))
+		dst = u.appendEscapedPath(dst)
 	}
-	if bytes.Compare(u.RawQuery, EmptyByte) != 0 {
-		buf.WriteByte('?')
-		buf.Write(u.RawQuery)
+	if u.ForceQuery || len(u.RawQuery) > 0 {
+		dst = append(dst, '?')
+		dst = append(dst, u.RawQuery...)
 	}
-	if bytes.Compare(u.Fragment, EmptyByte) != 0 {
-		buf.WriteByte('#')
-		buf.Write(escape(u.Fragment, encodeFragment))
+	if u.ForceFragment || len(u.Fragment) > 0 {
+		dst = append(dst, '#')
+		dst = u.appendEscapedFragment(dst)
 	}
-	return buf.Bytes()
+	return dst
 }
 
 // resolvePath applies special path segments from refs and applies
@@ -534,48 +1251,79 @@ func (u *URL) Parse(ref []byte) (*URL, error) {
 // ignores base and returns a copy of ref.
 func (u *URL) ResolveReference(ref *URL) *URL {
 	url := *ref
+	url.setUserFrom(ref)
 	if bytes.Equal(ref.Scheme, EmptyByte) {
 		url.Scheme = u.Scheme
 	}
 	if bytes.Compare(ref.Scheme, EmptyByte) != 0 || bytes.Compare(ref.Host, EmptyByte) != 0 || ref.User != nil {
 		// The "absoluteURI" or "net_path" cases.
-		url.Path = resolvePath(ref.Path, EmptyByte)
+		// We can ignore the error from setPath since we know we provided a
+		// validly-escaped path.
+		url.setPath(resolvePath(ref.EscapedPath(), EmptyByte), nil)
 		return &url
 	}
 	if bytes.Compare(ref.Opaque, EmptyByte) != 0 {
 		url.User = nil
 		url.Host = EmptyByte
+		url.RawHost = EmptyByte
+		url.ForceHost = false
 		url.Path = EmptyByte
+		url.RawPath = EmptyByte
 		return &url
 	}
 	if bytes.Equal(ref.Path, EmptyByte) {
-		if bytes.Equal(ref.RawQuery, EmptyByte) {
+		if !ref.ForceQuery && bytes.Equal(ref.RawQuery, EmptyByte) {
 			url.RawQuery = u.RawQuery
-			if bytes.Equal(ref.Fragment, EmptyByte) {
+			if !ref.ForceFragment && bytes.Equal(ref.Fragment, EmptyByte) {
 				url.Fragment = u.Fragment
+				url.RawFragment = u.RawFragment
+				url.ForceFragment = u.ForceFragment
 			}
 		}
 	}
 	// The "abs_path" or "rel_path" cases.
 	url.Host = u.Host
-	url.User = u.User
-	url.Path = resolvePath(u.Path, ref.Path)
+	url.RawHost = u.RawHost
+	url.setUserFrom(u)
+	url.OmitHost = u.OmitHost
+	url.ForceHost = u.ForceHost
+	url.setPath(resolvePath(u.EscapedPath(), ref.EscapedPath()), nil)
 	return &url
 }
 
+// setUserFrom sets u.User to src.User. A Userinfo stored in src
+// itself by ParseInto is copied into u, so that reusing src does not
+// change u.
+func (u *URL) setUserFrom(src *URL) {
+	if src.User == &src.userinfo {
+		u.userinfo = src.userinfo
+		u.User = &u.userinfo
+		return
+	}
+	u.User = src.User
+}
+
 // Query parses RawQuery and returns the corresponding values.
 func (u *URL) Query() Values {
 	v, _ := ParseQuery(u.RawQuery)
 	return v
 }
 
+// QueryOrdered parses RawQuery and returns the corresponding pairs in
+// the order they appear. It silently discards malformed value pairs.
+// To check errors use ParseQueryOrdered.
+func (u *URL) QueryOrdered() OrderedValues {
+	v, _ := ParseQueryOrdered(u.RawQuery)
+	return v
+}
+
 // RequestURI returns the encoded path?query or opaque?query
 // string that would be used in an HTTP request for u.
 func (u *URL) RequestURI() (result []byte) {
 	var buffer bytes.Buffer
 	result = u.Opaque
 	if bytes.Equal(result, EmptyByte) {
-		result = escape(u.Path, encodePath)
+		result = u.EscapedPath()
 		if bytes.Equal(result, EmptyByte) {
 			result = SlashByte
 		}
@@ -585,7 +1333,7 @@ func (u *URL) RequestURI() (result []byte) {
 		}
 	}
 	buffer.Write(result)
-	if bytes.Compare(u.RawQuery, EmptyByte) != 0 {
+	if u.ForceQuery || bytes.Compare(u.RawQuery, EmptyByte) != 0 {
 		buffer.Write(QuestionMarkByte)
 		buffer.Write(u.RawQuery)
 	}
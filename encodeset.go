@@ -0,0 +1,150 @@
+package bytesurl
+
+// An EncodeSet is the set of bytes that escaping percent-encodes,
+// stored as a 256-bit table indexed by byte value. The zero value is
+// the empty set. Sets are values: Add, Remove and Union return a
+// modified copy, so the predefined sets can be safely extended.
+type EncodeSet [4]uint64
+
+// NewEncodeSet returns the set of the bytes in chars.
+func NewEncodeSet(chars string) EncodeSet {
+	return EncodeSet{}.Add(chars)
+}
+
+// Contains reports whether c is in s.
+func (s EncodeSet) Contains(c byte) bool {
+	return s[c>>6]&(1<<(c&63)) != 0
+}
+
+// Add returns s with the bytes in chars added.
+func (s EncodeSet) Add(chars string) EncodeSet {
+	for i := 0; i < len(chars); i++ {
+		c := chars[i]
+		s[c>>6] |= 1 << (c & 63)
+	}
+	return s
+}
+
+// AddRange returns s with the bytes from lo to hi inclusive added.
+func (s EncodeSet) AddRange(lo, hi byte) EncodeSet {
+	for c := int(lo); c <= int(hi); c++ {
+		s[c>>6] |= 1 << (uint(c) & 63)
+	}
+	return s
+}
+
+// Remove returns s with the bytes in chars removed.
+func (s EncodeSet) Remove(chars string) EncodeSet {
+	for i := 0; i < len(chars); i++ {
+		c := chars[i]
+		s[c>>6] &^= 1 << (c & 63)
+	}
+	return s
+}
+
+// RemoveRange returns s with the bytes from lo to hi inclusive removed.
+func (s EncodeSet) RemoveRange(lo, hi byte) EncodeSet {
+	for c := int(lo); c <= int(hi); c++ {
+		s[c>>6] &^= 1 << (uint(c) & 63)
+	}
+	return s
+}
+
+// Union returns the set of the bytes in s or t.
+func (s EncodeSet) Union(t EncodeSet) EncodeSet {
+	for i := range s {
+		s[i] |= t[i]
+	}
+	return s
+}
+
+// escapeAllBut returns the set of all bytes except the RFC 3986 §2.3
+// unreserved characters and the bytes in allowed.
+func escapeAllBut(allowed string) EncodeSet {
+	return EncodeSet{^uint64(0), ^uint64(0), ^uint64(0), ^uint64(0)}.
+		RemoveRange('A', 'Z').RemoveRange('a', 'z').RemoveRange('0', '9').
+		Remove("-._~" + allowed)
+}
+
+// The RFC 3986 encode sets used by the Encoding modes. Each escapes
+// everything but the unreserved characters and the reserved ones the
+// component may contain literally.
+var (
+	// RFC3986Path allows : @ & = + $ (§3.3). The RFC saves / ; , for
+	// assigning meaning to individual path segments, but a whole path
+	// keeps them, which leaves only ? to escape.
+	RFC3986Path = escapeAllBut("$&+,/:;=@")
+
+	// RFC3986PathSegment escapes / ; , and ? within one path segment.
+	RFC3986PathSegment = escapeAllBut("$&+:=@")
+
+	// RFC3986Userinfo allows ; & = + $ , (§3.2.1). The parsing of
+	// userinfo treats ':' as special, so it is escaped too.
+	RFC3986Userinfo = escapeAllBut("$&+,;=")
+
+	// RFC3986QueryComponent escapes every reserved character (§3.4),
+	// so the result can be used as a key or value in a query.
+	RFC3986QueryComponent = escapeAllBut("")
+
+	// RFC3986Fragment escapes no reserved character: the RFC text is
+	// silent but the grammar allows everything (§4.1).
+	RFC3986Fragment = escapeAllBut("$&+,/:;=?@")
+
+	// RFC3986Host allows the sub-delims of reg-name (§3.2.2), ':' for
+	// the port and '[' ']' for IP literals. Non-ASCII bytes are kept
+	// as is; hosts are never percent-decoded apart from zone identifiers.
+	RFC3986Host = escapeAllBut("!$&'()*+,;=:[]").RemoveRange(0x80, 0xff)
+)
+
+// The percent-encode sets of the WHATWG URL Standard.
+// See https://url.spec.whatwg.org/#percent-encoded-bytes.
+var (
+	WHATWGC0Control    = EncodeSet{}.AddRange(0, 0x1f).AddRange(0x7f, 0xff)
+	WHATWGFragment     = WHATWGC0Control.Add(" \"<>`")
+	WHATWGQuery        = WHATWGC0Control.Add(" \"#<>")
+	WHATWGSpecialQuery = WHATWGQuery.Add("'")
+	WHATWGPath         = WHATWGQuery.Add("?^`{}")
+	WHATWGUserinfo     = WHATWGPath.Add("/:;=@[\\]^|")
+	WHATWGComponent    = WHATWGUserinfo.Add("$%&+,")
+
+	// WHATWGForm is the application/x-www-form-urlencoded set. The
+	// standard writes spaces as '+' in forms, which EscapeWith does
+	// not; use QueryEscape for that.
+	WHATWGForm = WHATWGComponent.Add("!'()~")
+)
+
+var encodeSets = [...]EncodeSet{
+	EncodePath:           RFC3986Path,
+	EncodePathSegment:    RFC3986PathSegment,
+	EncodeUserPassword:   RFC3986Userinfo,
+	EncodeQueryComponent: RFC3986QueryComponent,
+	EncodeFragment:       RFC3986Fragment,
+	EncodeHost:           RFC3986Host,
+	EncodeZone:           RFC3986Host,
+}
+
+// EncodeSet returns the set of bytes escaped in mode. Unknown modes
+// escape everything but the unreserved characters.
+func (e Encoding) EncodeSet() EncodeSet {
+	if e > 0 && int(e) < len(encodeSets) {
+		return encodeSets[e]
+	}
+	return RFC3986QueryComponent
+}
+
+// EscapeWith percent-encodes the bytes of src that are in set. If
+// there are none, src itself is returned.
+func EscapeWith(src []byte, set EncodeSet) []byte {
+	_, hexCount := countShouldEscape(src, &set, false)
+	if hexCount == 0 {
+		return src
+	}
+	return appendEscaped(make([]byte, 0, len(src)+2*hexCount), src, &set, false)
+}
+
+// AppendEscapeWith appends src to dst, percent-encoding the bytes that
+// are in set, and returns the extended buffer.
+func AppendEscapeWith(dst, src []byte, set EncodeSet) []byte {
+	_, hexCount := countShouldEscape(src, &set, false)
+	return appendEscaped(grow(dst, len(src)+2*hexCount), src, &set, false)
+}
@@ -0,0 +1,93 @@
+package bytesurl
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodeSet(t *testing.T) {
+	s := NewEncodeSet("a/%")
+	for i := 0; i < 256; i++ {
+		c := byte(i)
+		want := c == 'a' || c == '/' || c == '%'
+		if s.Contains(c) != want {
+			t.Errorf("NewEncodeSet(%q).Contains(%q) = %v, want %v", "a/%", c, !want, want)
+		}
+	}
+	if s = s.Remove("a").AddRange(0xfe, 0xff); s.Contains('a') || !s.Contains('/') || !s.Contains(0xff) || s.Contains(0xfd) {
+		t.Errorf("Remove/AddRange produced %x", s)
+	}
+	if s = s.RemoveRange(0, 0xff); s != (EncodeSet{}) {
+		t.Errorf("RemoveRange(0, 0xff) left %x", s)
+	}
+	if u := NewEncodeSet("a").Union(NewEncodeSet("b")); u != NewEncodeSet("ab") {
+		t.Errorf("Union = %x, want %x", u, NewEncodeSet("ab"))
+	}
+	before := RFC3986Path
+	if RFC3986Path.Add("/"); RFC3986Path != before {
+		t.Errorf("Add modified the receiver")
+	}
+}
+
+func TestEncodingEncodeSet(t *testing.T) {
+	if EncodePath.EncodeSet() != RFC3986Path || EncodeZone.EncodeSet() != RFC3986Host {
+		t.Errorf("Encoding.EncodeSet does not return the RFC 3986 set of the mode")
+	}
+	if Encoding(0).EncodeSet() != RFC3986QueryComponent || Encoding(100).EncodeSet() != RFC3986QueryComponent {
+		t.Errorf("unknown Encoding does not escape all reserved characters")
+	}
+}
+
+// whatwgSetTests lists the printable ASCII characters of each WHATWG
+// percent-encode set, from https://url.spec.whatwg.org/#percent-encoded-bytes.
+var whatwgSetTests = []struct {
+	name      string
+	set       EncodeSet
+	printable string
+}{
+	{"C0 control", WHATWGC0Control, ""},
+	{"fragment", WHATWGFragment, " \"<>`"},
+	{"query", WHATWGQuery, " \"#<>"},
+	{"special-query", WHATWGSpecialQuery, " \"#'<>"},
+	{"path", WHATWGPath, " \"#<>?^`{}"},
+	{"userinfo", WHATWGUserinfo, " \"#/:;<=>?@[\\]^`{|}"},
+	{"component", WHATWGComponent, " \"#$%&+,/:;<=>?@[\\]^`{|}"},
+	{"form", WHATWGForm, " !\"#$%&'()+,/:;<=>?@[\\]^`{|}~"},
+}
+
+func TestWHATWGEncodeSets(t *testing.T) {
+	for _, tt := range whatwgSetTests {
+		for i := 0; i < 256; i++ {
+			c := byte(i)
+			want := c < 0x20 || c > 0x7e || bytes.IndexByte([]byte(tt.printable), c) >= 0
+			if tt.set.Contains(c) != want {
+				t.Errorf("%s set contains %q = %v, want %v", tt.name, c, !want, want)
+			}
+		}
+	}
+}
+
+var escapeWithTests = []struct {
+	in  []byte
+	set EncodeSet
+	out []byte
+}{
+	{[]byte("a b"), WHATWGFragment, []byte("a%20b")},
+	{[]byte("a+b c"), RFC3986QueryComponent, []byte("a%2Bb%20c")},
+	{[]byte("/ü?x"), WHATWGPath, []byte("/%C3%BC%3Fx")},
+	{[]byte("it's"), WHATWGSpecialQuery, []byte("it%27s")},
+	{[]byte("a~b"), WHATWGForm, []byte("a%7Eb")},
+	{[]byte("a~b"), RFC3986Path.Add("~"), []byte("a%7Eb")},
+	{[]byte("a/b"), RFC3986PathSegment.Remove("/"), []byte("a/b")},
+}
+
+func TestEscapeWith(t *testing.T) {
+	for _, tt := range escapeWithTests {
+		if got := EscapeWith(tt.in, tt.set); bytes.Compare(got, tt.out) != 0 {
+			t.Errorf("EscapeWith(%q) = %q, want %q", tt.in, got, tt.out)
+		}
+		if got := AppendEscapeWith([]byte("x"), tt.in, tt.set); bytes.Compare(got[1:], tt.out) != 0 || got[0] != 'x' {
+			t.Errorf("AppendEscapeWith(%q, %q) = %q, want %q", "x", tt.in, got, "x"+string(tt.out))
+		}
+	}
+}
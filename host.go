@@ -0,0 +1,305 @@
+package bytesurl
+
+import "bytes"
+
+// parseHost validates the host[:port] part of an authority. Bracketed
+// IP literals are checked against RFC 3986 §3.2.2 and RFC 6874, whose
+// "%25" zone separator is decoded so the returned host holds a plain '%'.
+// Errors are located relative to host, see errorAt.
+func parseHost(host []byte) ([]byte, error) {
+	if len(host) > 0 && host[0] == '[' {
+		i := bytes.LastIndexByte(host, ']')
+		if i < 0 {
+			return EmptyByte, errorAt(ComponentHost, 0, ErrMissingBracket)
+		}
+		if !validOptionalPort(host[i+1:]) {
+			return EmptyByte, errorAt(ComponentPort, i+1, ErrInvalidPort)
+		}
+		literal := host[1:i]
+		zone := bytes.Index(literal, ZoneByte)
+		if zone < 0 {
+			if !validIPLiteral(literal, false) {
+				return EmptyByte, errorAt(ComponentHost, 1, ErrInvalidIPLiteral)
+			}
+			return host, nil
+		}
+		if !validIPLiteral(literal[:zone], true) {
+			return EmptyByte, errorAt(ComponentHost, 1, ErrInvalidIPLiteral)
+		}
+		z, err := unescape(literal[zone:], EncodeZone)
+		if err != nil {
+			return EmptyByte, errorAt(ComponentHost, 1+zone, err)
+		}
+		if len(z) < 2 {
+			// "%25" must be followed by a non-empty zone identifier.
+			return EmptyByte, errorAt(ComponentHost, 1+zone, ErrInvalidIPLiteral)
+		}
+		h := make([]byte, 0, 1+zone+len(z)+len(host)-i)
+		h = append(h, host[:zone+1]...)
+		h = append(h, z...)
+		return append(h, host[i:]...), nil
+	}
+	if i := bytes.IndexByte(host, '%'); i >= 0 {
+		return EmptyByte, errorAt(ComponentHost, i, ErrHexadeciamlEscape)
+	}
+	if i := bytes.LastIndexByte(host, ':'); i >= 0 && !validOptionalPort(host[i:]) {
+		return EmptyByte, errorAt(ComponentPort, i, ErrInvalidPort)
+	}
+	return host, nil
+}
+
+// hostZone returns the bounds of the zone identifier in host, a
+// bracketed IP literal with an optional port: host[start] is the '%'
+// before the zone and host[end] the closing ']'. start is -1 if host
+// has no zone.
+func hostZone(host []byte) (start, end int) {
+	if len(host) == 0 || host[0] != '[' {
+		return -1, -1
+	}
+	if end = bytes.LastIndexByte(host, ']'); end < 0 {
+		return -1, -1
+	}
+	return bytes.IndexByte(host[:end], '%'), end
+}
+
+// escapeHost returns host as it is written back into a URL. parseHost
+// decodes nothing but the zone identifier of an IP literal, so only
+// the zone is escaped, its '%' becoming "%25"; any other byte, such as
+// a space or a non-ASCII byte of a reg-name, is written as is so that
+// the result parses back to host.
+func escapeHost(host []byte) []byte {
+	if start, _ := hostZone(host); start < 0 {
+		return host
+	}
+	return appendEscapeHost(make([]byte, 0, escapeHostLen(host)), host)
+}
+
+// escapeHostLen returns len(escapeHost(host)).
+func escapeHostLen(host []byte) int {
+	start, end := hostZone(host)
+	if start < 0 {
+		return len(host)
+	}
+	return len(host) - (end - start) + EscapedLen(host[start:end], EncodeZone)
+}
+
+// appendEscapeHost appends escapeHost(host) to dst.
+func appendEscapeHost(dst, host []byte) []byte {
+	start, end := hostZone(host)
+	if start < 0 {
+		return append(dst, host...)
+	}
+	dst = append(dst, host[:start]...)
+	dst = appendEscape(dst, host[start:end], EncodeZone)
+	return append(dst, host[end:]...)
+}
+
+// validOptionalPort reports whether port is either an empty string
+// or matches /^:\d*$/
+func validOptionalPort(port []byte) bool {
+	if len(port) == 0 {
+		return true
+	}
+	if port[0] != ':' {
+		return false
+	}
+	for _, b := range port[1:] {
+		if b < '0' || b > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// validIPLiteral reports whether addr is the content of an RFC 3986
+// IP-literal: an IPv6 address or, when no zone follows, an IPvFuture.
+func validIPLiteral(addr []byte, zoned bool) bool {
+	if len(addr) > 0 && (addr[0] == 'v' || addr[0] == 'V') {
+		return !zoned && validIPvFuture(addr)
+	}
+	return validIPv6(addr)
+}
+
+// validIPv6 reports whether addr is an IPv6address as defined by
+// RFC 3986 §3.2.2: eight groups of up to four hex digits, at most one
+// "::" elision, and optionally a trailing dotted-quad IPv4 address.
+func validIPv6(addr []byte) bool {
+	groups, ellipsis := 0, false
+	if len(addr) >= 2 && addr[0] == ':' && addr[1] == ':' {
+		ellipsis = true
+		addr = addr[2:]
+	}
+	for len(addr) > 0 {
+		n := 0
+		for n < len(addr) && n < 5 && ishex(addr[n]) {
+			n++
+		}
+		if n < len(addr) && addr[n] == '.' {
+			// IPv4 suffix takes the place of the last two groups.
+			if !validIPv4(addr) {
+				return false
+			}
+			groups += 2
+			break
+		}
+		if n == 0 || n > 4 {
+			return false
+		}
+		groups++
+		addr = addr[n:]
+		if len(addr) == 0 {
+			break
+		}
+		if addr[0] != ':' || len(addr) == 1 {
+			return false
+		}
+		addr = addr[1:]
+		if addr[0] == ':' {
+			if ellipsis {
+				return false
+			}
+			ellipsis = true
+			addr = addr[1:]
+		}
+	}
+	if ellipsis {
+		return groups < 8
+	}
+	return groups == 8
+}
+
+// validIPv4 reports whether addr is a dotted-quad IPv4address.
+func validIPv4(addr []byte) bool {
+	for i := 0; i < 4; i++ {
+		if i > 0 {
+			if len(addr) == 0 || addr[0] != '.' {
+				return false
+			}
+			addr = addr[1:]
+		}
+		n, v := 0, 0
+		for n < len(addr) && '0' <= addr[n] && addr[n] <= '9' {
+			v = v*10 + int(addr[n]-'0')
+			n++
+			if n > 3 || v > 255 {
+				return false
+			}
+		}
+		if n == 0 || n > 1 && addr[0] == '0' {
+			return false
+		}
+		addr = addr[n:]
+	}
+	return len(addr) == 0
+}
+
+// validIPvFuture reports whether addr matches
+// "v" 1*HEXDIG "." 1*( unreserved / sub-delims / ":" ).
+func validIPvFuture(addr []byte) bool {
+	i := 1
+	for i < len(addr) && ishex(addr[i]) {
+		i++
+	}
+	if i == 1 || i >= len(addr)-1 || addr[i] != '.' {
+		return false
+	}
+	for _, c := range addr[i+1:] {
+		if c != ':' && (c >= 0x80 || c == '[' || c == ']' || shouldEscape(c, EncodeHost)) {
+			return false
+		}
+	}
+	return true
+}
+
+// splitHostPort separates host and port. If the port is not valid, it returns
+// the entire input as host, and it doesn't check the validity of the host.
+func splitHostPort(hostport []byte) (host, port []byte) {
+	host = hostport
+	port = EmptyByte
+	if colon := bytes.LastIndexByte(host, ':'); colon >= 0 && validOptionalPort(host[colon:]) {
+		host, port = host[:colon], host[colon+1:]
+	}
+	if len(host) > 1 && host[0] == '[' && host[len(host)-1] == ']' {
+		host = host[1 : len(host)-1]
+	}
+	return
+}
+
+// Hostname returns u.Host, stripping any valid port number if present.
+//
+// If the result is enclosed in square brackets, as literal IPv6 addresses
+// are, the square brackets are removed from the result.
+func (u *URL) Hostname() []byte {
+	host, _ := splitHostPort(u.Host)
+	return host
+}
+
+// Port returns the port part of u.Host, without the leading colon.
+//
+// If u.Host doesn't contain a valid numeric port, Port returns an empty slice.
+func (u *URL) Port() []byte {
+	_, port := splitHostPort(u.Host)
+	return port
+}
+
+// SplitHostPort splits a network address of the form "host",
+// "host:port", "[host]" or "[host]:port" into host and port.
+// Unlike net.SplitHostPort the port is optional and is returned
+// empty when absent. A literal IPv6 address must be enclosed in
+// square brackets; the brackets are not part of the returned host.
+// Both results are sub-slices of hostport.
+func SplitHostPort(hostport []byte) (host, port []byte, err error) {
+	if len(hostport) > 0 && hostport[0] == '[' {
+		i := bytes.IndexByte(hostport, ']')
+		if i < 0 {
+			return EmptyByte, EmptyByte, ErrMissingBracket
+		}
+		if !validOptionalPort(hostport[i+1:]) {
+			return EmptyByte, EmptyByte, ErrInvalidPort
+		}
+		host, port = hostport[1:i], EmptyByte
+		if i+1 < len(hostport) {
+			port = hostport[i+2:]
+		}
+		return host, port, nil
+	}
+	i := bytes.IndexByte(hostport, ':')
+	if i < 0 {
+		return hostport, EmptyByte, nil
+	}
+	if bytes.IndexByte(hostport[i+1:], ':') >= 0 {
+		return EmptyByte, EmptyByte, ErrTooManyColons
+	}
+	if !validOptionalPort(hostport[i:]) {
+		return EmptyByte, EmptyByte, ErrInvalidPort
+	}
+	return hostport[:i], hostport[i+1:], nil
+}
+
+// JoinHostPort combines host and port into a network address of the
+// form "host:port". If host contains a colon, as found in literal IPv6
+// addresses, then JoinHostPort returns "[host]:port". An empty port
+// is omitted together with its colon.
+func JoinHostPort(host, port []byte) []byte {
+	n := len(host)
+	if len(port) > 0 {
+		n += 1 + len(port)
+	}
+	bracket := bytes.IndexByte(host, ':') >= 0
+	if bracket {
+		n += 2
+	}
+	b := make([]byte, 0, n)
+	if bracket {
+		b = append(b, '[')
+		b = append(b, host...)
+		b = append(b, ']')
+	} else {
+		b = append(b, host...)
+	}
+	if len(port) > 0 {
+		b = append(b, ':')
+		b = append(b, port...)
+	}
+	return b
+}
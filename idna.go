@@ -0,0 +1,353 @@
+package bytesurl
+
+import (
+	"bytes"
+	"errors"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Errors returned by the Punycode and IDNA conversions.
+var (
+	ErrPunycodeInput    = errors.New("invalid punycode input")
+	ErrPunycodeOverflow = errors.New("punycode overflow")
+	ErrInvalidIDNA      = errors.New("invalid internationalized domain name")
+	ErrDomainTooLong    = errors.New("domain name or label too long")
+)
+
+// Length limits of a domain name in bytes, RFC 1034 §3.1 and RFC 5890
+// §2.3.2.1, enforced on the A-label form by ToASCII and ToUnicode.
+const (
+	maxLabelLength  = 63
+	maxDomainLength = 253 // without the trailing root dot
+)
+
+// ACEPrefix is the ASCII Compatible Encoding prefix of an IDNA A-label.
+var ACEPrefix = []byte("xn--")
+
+// Bootstring parameters for Punycode, RFC 3492 §5.
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 128
+	punyDelimiter   = '-'
+	punyMaxInt      = 1<<31 - 1
+)
+
+// PunycodeEncode encodes the UTF-8 label using Punycode as defined in
+// RFC 3492. The result does not include the "xn--" prefix. The time it
+// takes grows with the square of the length of label, which is not
+// limited here; ToASCII rejects labels too long for a domain first.
+func PunycodeEncode(label []byte) ([]byte, error) {
+	if !utf8.Valid(label) {
+		return nil, ErrPunycodeInput
+	}
+	input := bytes.Runes(label)
+	output := make([]byte, 0, len(label)+8)
+	for _, r := range input {
+		if r < 0x80 {
+			output = append(output, byte(r))
+		}
+	}
+	b := len(output)
+	h := b
+	if b > 0 {
+		output = append(output, punyDelimiter)
+	}
+	n, delta, bias := rune(punyInitialN), 0, punyInitialBias
+	for h < len(input) {
+		m := rune(punyMaxInt)
+		for _, r := range input {
+			if r >= n && r < m {
+				m = r
+			}
+		}
+		if int(m-n) > (punyMaxInt-delta)/(h+1) {
+			return nil, ErrPunycodeOverflow
+		}
+		delta += int(m-n) * (h + 1)
+		n = m
+		for _, r := range input {
+			if r < n {
+				delta++
+				if delta > punyMaxInt {
+					return nil, ErrPunycodeOverflow
+				}
+			}
+			if r != n {
+				continue
+			}
+			q := delta
+			for k := punyBase; ; k += punyBase {
+				t := punyThreshold(k, bias)
+				if q < t {
+					break
+				}
+				output = append(output, punyDigit(t+(q-t)%(punyBase-t)))
+				q = (q - t) / (punyBase - t)
+			}
+			output = append(output, punyDigit(q))
+			bias = punyAdapt(delta, h+1, h == b)
+			delta = 0
+			h++
+		}
+		delta++
+		n++
+	}
+	return output, nil
+}
+
+// PunycodeDecode decodes the Punycode label, without the "xn--" prefix,
+// into UTF-8 as defined in RFC 3492.
+func PunycodeDecode(label []byte) ([]byte, error) {
+	var output []rune
+	b := bytes.LastIndexByte(label, punyDelimiter)
+	if b < 0 {
+		b = 0
+	}
+	for _, c := range label[:b] {
+		if c >= 0x80 {
+			return nil, ErrPunycodeInput
+		}
+		output = append(output, rune(c))
+	}
+	if b > 0 {
+		b++
+	}
+	n, i, bias := rune(punyInitialN), 0, punyInitialBias
+	for in := b; in < len(label); {
+		oldi, w := i, 1
+		for k := punyBase; ; k += punyBase {
+			if in >= len(label) {
+				return nil, ErrPunycodeInput
+			}
+			digit, ok := punyDecodeDigit(label[in])
+			in++
+			if !ok {
+				return nil, ErrPunycodeInput
+			}
+			if digit > (punyMaxInt-i)/w {
+				return nil, ErrPunycodeOverflow
+			}
+			i += digit * w
+			t := punyThreshold(k, bias)
+			if digit < t {
+				break
+			}
+			if w > punyMaxInt/(punyBase-t) {
+				return nil, ErrPunycodeOverflow
+			}
+			w *= punyBase - t
+		}
+		bias = punyAdapt(i-oldi, len(output)+1, oldi == 0)
+		if i/(len(output)+1) > punyMaxInt-int(n) {
+			return nil, ErrPunycodeOverflow
+		}
+		n += rune(i / (len(output) + 1))
+		i %= len(output) + 1
+		if n < punyInitialN || n > unicode.MaxRune || 0xd800 <= n && n <= 0xdfff {
+			return nil, ErrPunycodeInput
+		}
+		output = append(output, 0)
+		copy(output[i+1:], output[i:])
+		output[i] = n
+		i++
+	}
+	return []byte(string(output)), nil
+}
+
+func punyThreshold(k, bias int) int {
+	switch {
+	case k <= bias:
+		return punyTMin
+	case k >= bias+punyTMax:
+		return punyTMax
+	}
+	return k - bias
+}
+
+func punyAdapt(delta, numPoints int, firstTime bool) int {
+	if firstTime {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+	k := 0
+	for delta > ((punyBase-punyTMin)*punyTMax)/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
+
+func punyDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+func punyDecodeDigit(c byte) (int, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return int(c - '0' + 26), true
+	case 'a' <= c && c <= 'z':
+		return int(c - 'a'), true
+	case 'A' <= c && c <= 'Z':
+		return int(c - 'A'), true
+	}
+	return 0, false
+}
+
+// ToASCII converts a domain name to its IDNA A-label form: every label
+// containing non-ASCII characters is lower-cased and replaced by "xn--"
+// followed by its Punycode encoding. ASCII labels are lower-cased. The
+// ideographic full stops U+3002, U+FF0E and U+FF61 separate labels like
+// '.', as in IDNA2003.
+//
+// Only case folding is applied before encoding; the Unicode
+// normalization and mapping tables of UTS #46 are not.
+//
+// A domain that needs encoding fails with ErrDomainTooLong if one of
+// its A-labels exceeds 63 bytes or the result exceeds 253, which is
+// checked before encoding so that hostile input cannot stall it.
+// ASCII domains are only lower-cased and are not limited.
+func ToASCII(domain []byte) ([]byte, error) {
+	if !utf8.Valid(domain) {
+		return nil, ErrInvalidIDNA
+	}
+	if isASCIIBytes(domain) {
+		return lower(domain), nil
+	}
+	// Every rune takes at least one byte of the A-label form, so
+	// counting runes rejects the domains that cannot fit early.
+	if err := checkIDNALength(domain); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(domain)+8)
+	for len(domain) > 0 {
+		label, rest, dot := cutIDNALabel(domain)
+		domain = rest
+		label = bytes.Map(unicode.ToLower, label)
+		if isASCIIBytes(label) {
+			out = append(out, label...)
+		} else {
+			enc, err := PunycodeEncode(label)
+			if err != nil {
+				return nil, err
+			}
+			if len(ACEPrefix)+len(enc) > maxLabelLength {
+				return nil, ErrDomainTooLong
+			}
+			out = append(out, ACEPrefix...)
+			out = append(out, enc...)
+		}
+		if dot {
+			out = append(out, '.')
+		}
+	}
+	if len(out) > maxDomainLength && (len(out) > maxDomainLength+1 || out[len(out)-1] != '.') {
+		return nil, ErrDomainTooLong
+	}
+	return out, nil
+}
+
+// ToUnicode converts a domain name to its IDNA U-label form: every
+// label starting with "xn--" is replaced by its Punycode decoding.
+// Other labels are returned unchanged. A domain with A-labels fails
+// with ErrDomainTooLong if a label exceeds 63 bytes or the domain 253,
+// before any decoding.
+func ToUnicode(domain []byte) ([]byte, error) {
+	if bytes.Index(lower(domain), ACEPrefix) < 0 {
+		return domain, nil
+	}
+	if err := checkIDNALength(domain); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 0, len(domain))
+	for len(domain) > 0 {
+		label, rest, dot := cutIDNALabel(domain)
+		domain = rest
+		if len(label) > len(ACEPrefix) && bytes.EqualFold(label[:len(ACEPrefix)], ACEPrefix) {
+			dec, err := PunycodeDecode(label[len(ACEPrefix):])
+			if err != nil {
+				return nil, err
+			}
+			label = dec
+		}
+		out = append(out, label...)
+		if dot {
+			out = append(out, '.')
+		}
+	}
+	return out, nil
+}
+
+// checkIDNALength returns ErrDomainTooLong if a label of domain has
+// more than 63 runes or the whole domain, without a trailing root dot,
+// more than 253.
+func checkIDNALength(domain []byte) error {
+	total := 0
+	for len(domain) > 0 {
+		label, rest, dot := cutIDNALabel(domain)
+		domain = rest
+		n := utf8.RuneCount(label)
+		if n > maxLabelLength {
+			return ErrDomainTooLong
+		}
+		total += n
+		if dot && len(rest) > 0 {
+			total++
+		}
+	}
+	if total > maxDomainLength {
+		return ErrDomainTooLong
+	}
+	return nil
+}
+
+// cutIDNALabel returns the first label of domain, the domain after the
+// label separator and whether a separator was found.
+func cutIDNALabel(domain []byte) (label, rest []byte, dot bool) {
+	for i := 0; i < len(domain); {
+		r, size := utf8.DecodeRune(domain[i:])
+		switch r {
+		case '.', '。', '．', '｡':
+			return domain[:i], domain[i+size:], true
+		}
+		i += size
+	}
+	return domain, EmptyByte, false
+}
+
+// hostToASCII applies ToASCII to the host name of a host[:port] field,
+// leaving IP literals and the port untouched. Host names that need
+// encoding are subject to the length limits of ToASCII.
+func hostToASCII(host []byte) ([]byte, error) {
+	if isASCIIBytes(host) || host[0] == '[' {
+		return host, nil
+	}
+	name, port := host, EmptyByte
+	if i := bytes.LastIndexByte(host, ':'); i >= 0 {
+		name, port = host[:i], host[i:]
+	}
+	ascii, err := ToASCII(name)
+	if err != nil {
+		return nil, err
+	}
+	return append(ascii, port...), nil
+}
+
+func isASCIIBytes(s []byte) bool {
+	for _, c := range s {
+		if c >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,153 @@
+package bytesurl
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Sample strings from RFC 3492 §7.1.
+var punycodeTests = []struct {
+	unicode, punycode string
+}{
+	{"", ""},
+	{"-> $1.00 <-", "-> $1.00 <--"},
+	{"bücher", "bcher-kva"},
+	{"münchen", "mnchen-3ya"},
+	{"ليهمابتكلموشعربي؟", "egbpdaj6bu4bxfgehfvwxn"},
+	{"他们为什么不说中文", "ihqwcrb4cv8a8dqg056pqjye"},
+	{"Pročprostěnemluvíčesky", "Proprostnemluvesky-uyb24dma41a"},
+	{"почемужеонинеговорятпорусски", "b1abfaaepdrnnbgefbadotcwatmq2g4l"},
+	{"3年B組金八先生", "3B-ww4c5e180e575a65lsy2b"},
+	{"安室奈美恵-with-SUPER-MONKEYS", "-with-SUPER-MONKEYS-pc58ag80a8qai00g7n9n"},
+	{"MajiでKoiする5秒前", "MajiKoi5-783gue6qz075azm5e"},
+}
+
+func TestPunycode(t *testing.T) {
+	for _, tt := range punycodeTests {
+		enc, err := PunycodeEncode([]byte(tt.unicode))
+		if err != nil || string(enc) != tt.punycode {
+			t.Errorf("PunycodeEncode(%q) = %q, %v; want %q", tt.unicode, enc, err, tt.punycode)
+		}
+		dec, err := PunycodeDecode([]byte(tt.punycode))
+		if err != nil || string(dec) != tt.unicode {
+			t.Errorf("PunycodeDecode(%q) = %q, %v; want %q", tt.punycode, dec, err, tt.unicode)
+		}
+	}
+}
+
+func TestPunycodeDecodeErrors(t *testing.T) {
+	for _, in := range []string{"a-é", "kva!", "bcher-kv9999999999", "-x"} {
+		if dec, err := PunycodeDecode([]byte(in)); err == nil {
+			t.Errorf("PunycodeDecode(%q) = %q; want error", in, dec)
+		}
+	}
+}
+
+var idnaTests = []struct {
+	unicode, ascii string
+}{
+	{"example.com", "example.com"},
+	{"bücher.example", "xn--bcher-kva.example"},
+	{"münchen.de.", "xn--mnchen-3ya.de."},
+	{"日本語。jp", "xn--wgv71a119e.jp"},
+}
+
+func TestToASCII(t *testing.T) {
+	for _, tt := range idnaTests {
+		got, err := ToASCII([]byte(tt.unicode))
+		if err != nil || string(got) != tt.ascii {
+			t.Errorf("ToASCII(%q) = %q, %v; want %q", tt.unicode, got, err, tt.ascii)
+		}
+	}
+	if got, err := ToASCII([]byte("BÜCHER.Example")); err != nil || string(got) != "xn--bcher-kva.example" {
+		t.Errorf("ToASCII did not fold case: %q, %v", got, err)
+	}
+	if _, err := ToASCII([]byte("b\xffcher")); err != ErrInvalidIDNA {
+		t.Errorf("ToASCII of invalid UTF-8 returned %v; want %v", err, ErrInvalidIDNA)
+	}
+}
+
+func TestToUnicode(t *testing.T) {
+	for _, tt := range idnaTests[:3] {
+		got, err := ToUnicode([]byte(tt.ascii))
+		if err != nil || string(got) != tt.unicode {
+			t.Errorf("ToUnicode(%q) = %q, %v; want %q", tt.ascii, got, err, tt.unicode)
+		}
+	}
+	if got, err := ToUnicode([]byte("XN--bcher-kva.example")); err != nil || string(got) != "bücher.example" {
+		t.Errorf("ToUnicode did not accept upper-case prefix: %q, %v", got, err)
+	}
+	if _, err := ToUnicode([]byte("xn--a-é.example")); err == nil {
+		t.Errorf("ToUnicode accepted invalid punycode")
+	}
+}
+
+func TestParseIDNA(t *testing.T) {
+	u, err := ParseOptions{IDNA: true}.Parse([]byte("http://user@bücher.example:8080/straße"))
+	if err != nil {
+		t.Fatalf("Parse returned error %s", err)
+	}
+	if want := []byte("xn--bcher-kva.example:8080"); !bytes.Equal(u.Host, want) {
+		t.Errorf("Host = %q; want %q", u.Host, want)
+	}
+	if want := "http://user@xn--bcher-kva.example:8080/stra%C3%9Fe"; u.String() != want {
+		t.Errorf("String() = %q; want %q", u.String(), want)
+	}
+	u, err = Parse([]byte("http://bücher.example/"))
+	if err != nil {
+		t.Fatalf("Parse returned error %s", err)
+	}
+	if want := []byte("bücher.example"); !bytes.Equal(u.Host, want) {
+		t.Errorf("Host without IDNA = %q; want %q", u.Host, want)
+	}
+	u, err = ParseWHATWG([]byte("https://Bücher.example/"), nil)
+	if err != nil {
+		t.Fatalf("ParseWHATWG returned error %s", err)
+	}
+	if want := "https://xn--bcher-kva.example/"; u.String() != want {
+		t.Errorf("ParseWHATWG String() = %q; want %q", u.String(), want)
+	}
+}
+
+func TestIDNALengthLimits(t *testing.T) {
+	// A label this long made the quadratic Punycode encoder stall.
+	huge := strings.Repeat("ü", 100000)
+	start := time.Now()
+	if _, err := ToASCII([]byte(huge)); err != ErrDomainTooLong {
+		t.Errorf("ToASCII of a %d-rune label returned %v; want %v", 100000, err, ErrDomainTooLong)
+	}
+	if _, err := ToUnicode([]byte("xn--" + strings.Repeat("a", 100000))); err != ErrDomainTooLong {
+		t.Errorf("ToUnicode of a long A-label returned %v; want %v", err, ErrDomainTooLong)
+	}
+	if _, err := (ParseOptions{IDNA: true}).Parse([]byte("http://" + huge + "/")); !errors.Is(err, ErrDomainTooLong) {
+		t.Errorf("Parse with IDNA of a long label returned %v; want %v", err, ErrDomainTooLong)
+	}
+	if _, err := ParseWHATWG([]byte("http://"+huge+"/"), nil); err == nil {
+		t.Errorf("ParseWHATWG accepted a long label")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("rejecting long labels took %v", d)
+	}
+
+	// "xn--bcher-kva." is 14 bytes, each "a." 2 more.
+	domain := "bücher." + strings.Repeat("a.", 119) + "a"
+	if got, err := ToASCII([]byte(domain)); err != nil || len(got) != 253 {
+		t.Errorf("ToASCII of a 253-byte domain = %d bytes, %v", len(got), err)
+	}
+	if _, err := ToASCII([]byte(domain + ".")); err != nil {
+		t.Errorf("ToASCII of a 253-byte domain with a root dot returned %v", err)
+	}
+	if _, err := ToASCII([]byte(domain + "a")); err != ErrDomainTooLong {
+		t.Errorf("ToASCII of a 254-byte domain returned %v; want %v", err, ErrDomainTooLong)
+	}
+	// 55 letters and a 'ü' encode to a 63-byte A-label, 56 to 64.
+	if got, err := ToASCII([]byte(strings.Repeat("a", 55) + "ü")); err != nil || len(got) != 63 {
+		t.Errorf("ToASCII of a 63-byte label = %q, %v", got, err)
+	}
+	if _, err := ToASCII([]byte(strings.Repeat("a", 56) + "ü")); err != ErrDomainTooLong {
+		t.Errorf("ToASCII of a label over 63 bytes returned %v; want %v", err, ErrDomainTooLong)
+	}
+}
@@ -0,0 +1,200 @@
+package bytesurl
+
+import (
+	"bytes"
+	"errors"
+	"unicode/utf8"
+)
+
+// ErrInvalidUTF8 is returned for an IRI, or a URL parsed with
+// ParseOptions.ValidUTF8, that is not valid UTF-8 once percent-decoded.
+var ErrInvalidUTF8 = errors.New("invalid UTF-8 in URL")
+
+// nonASCII is the set of bytes IRIToURI percent-encodes outside of the host.
+var nonASCII = EncodeSet{}.AddRange(utf8.RuneSelf, 0xff)
+
+// ParseIRI parses rawiri, an Internationalized Resource Identifier as
+// defined by RFC 3987, into a URL. The IRI is mapped to a URI with
+// IRIToURI first, so Host holds the A-label form of an internationalized
+// host name, while Path, Fragment and User hold the decoded Unicode
+// text. Input that is not valid UTF-8, even once percent-decoded, is
+// rejected with ErrInvalidUTF8.
+func ParseIRI(rawiri []byte) (*URL, error) {
+	return ParseOptions{}.ParseIRI(rawiri)
+}
+
+// ParseIRI is like the package-level ParseIRI but honours o. Errors
+// found after the conversion to a URI refer to the converted URI.
+func (o ParseOptions) ParseIRI(rawiri []byte) (*URL, error) {
+	if i := invalidUTF8Index(rawiri); i >= 0 {
+		return nil, parseError(rawiri, errorAt(componentAt(rawiri, i), i, ErrInvalidUTF8))
+	}
+	uri, err := IRIToURI(rawiri)
+	if err != nil {
+		start, _ := hostSpan(rawiri)
+		return nil, parseError(rawiri, errorAt(ComponentHost, start, err))
+	}
+	o.ValidUTF8 = true
+	return o.Parse(uri)
+}
+
+// IRIToURI maps an IRI to a URI as described in RFC 3987 §3.1: the
+// host is converted with ToASCII and every other non-ASCII byte is
+// percent-encoded. Characters that are not allowed in a URI anyway,
+// such as spaces, are left alone. iri must be valid UTF-8.
+func IRIToURI(iri []byte) ([]byte, error) {
+	if !utf8.Valid(iri) {
+		return nil, ErrInvalidUTF8
+	}
+	if isASCIIBytes(iri) {
+		return iri, nil
+	}
+	start, end := hostSpan(iri)
+	host, err := hostToASCII(iri[start:end])
+	if err != nil {
+		return nil, err
+	}
+	uri := AppendEscapeWith(make([]byte, 0, len(iri)+len(iri)/2), iri[:start], nonASCII)
+	uri = append(uri, host...)
+	return AppendEscapeWith(uri, iri[end:], nonASCII), nil
+}
+
+// URIToIRI maps a URI to an IRI as described in RFC 3987 §3.2: every
+// percent-encoded sequence of non-ASCII bytes that forms valid UTF-8
+// for a character an IRI allows is decoded, and A-labels in the host
+// are converted with ToUnicode. Escaped ASCII characters, such as %2F,
+// escapes that do not decode to valid UTF-8 and escapes of characters
+// isIRIChar rejects, such as C1 controls or bidi formatting characters,
+// are kept, so the result maps back to uri and displays like it.
+func URIToIRI(uri []byte) []byte {
+	start, end := hostSpan(uri)
+	host := uri[start:end]
+	if h, err := ToUnicode(host); err == nil {
+		host = h
+	}
+	if bytes.IndexByte(uri, '%') < 0 && bytes.Equal(host, uri[start:end]) {
+		return uri
+	}
+	rest, query, fragment := uri[end:], EmptyByte, EmptyByte
+	if i := bytes.IndexByte(rest, '#'); i >= 0 {
+		rest, fragment = rest[:i], rest[i:]
+	}
+	if i := bytes.IndexByte(rest, '?'); i >= 0 {
+		rest, query = rest[:i], rest[i:]
+	}
+	iri := appendDecodedUTF8(make([]byte, 0, len(uri)), uri[:start], false)
+	iri = append(iri, host...)
+	iri = appendDecodedUTF8(iri, rest, false)
+	iri = appendDecodedUTF8(iri, query, true)
+	return appendDecodedUTF8(iri, fragment, false)
+}
+
+// appendDecodedUTF8 appends s to dst, decoding the runs of escaped
+// non-ASCII bytes that form valid UTF-8 sequences of characters
+// isIRIChar allows; query tells whether s is the query.
+func appendDecodedUTF8(dst, s []byte, query bool) []byte {
+	var run [utf8.UTFMax]byte
+	for i := 0; i < len(s); {
+		n := 0
+		for j := i; n < len(run) && isHighEscape(s[j:]); j += 3 {
+			run[n] = unhex(s[j+1])<<4 | unhex(s[j+2])
+			n++
+			if utf8.FullRune(run[:n]) {
+				break
+			}
+		}
+		if n > 0 {
+			if r, size := utf8.DecodeRune(run[:n]); r != utf8.RuneError || size > 1 {
+				if isIRIChar(r, query) {
+					dst = append(dst, run[:size]...)
+				} else {
+					dst = append(dst, s[i:i+3*size]...)
+				}
+				i += 3 * size
+				continue
+			}
+		}
+		dst = append(dst, s[i])
+		i++
+	}
+	return dst
+}
+
+// isIRIChar reports whether r may appear unescaped in an IRI: it must
+// be a ucschar or, in the query, an iprivate (RFC 3987 §2.2). The bidi
+// formatting characters §4.1 forbids are rejected too, as are the
+// isolates and the Arabic letter mark added to Unicode since, so that
+// decoding cannot change the order in which an IRI is displayed.
+func isIRIChar(r rune, query bool) bool {
+	switch {
+	case r == 0x61C || r == 0x200E || r == 0x200F ||
+		0x202A <= r && r <= 0x202E || 0x2066 <= r && r <= 0x2069:
+		return false
+	case 0xA0 <= r && r <= 0xD7FF || 0xF900 <= r && r <= 0xFDCF || 0xFDF0 <= r && r <= 0xFFEF:
+		return true
+	case 0xE000 <= r && r <= 0xF8FF || 0xF0000 <= r && r <= 0xFFFFD || 0x100000 <= r && r <= 0x10FFFD:
+		return query
+	case 0x10000 <= r && r <= 0xEFFFD:
+		// Each plane but its last two code points, and not the
+		// tags and variation selectors of U+E0000-E0FFF.
+		return r&0xFFFF <= 0xFFFD && (r < 0xE0000 || r >= 0xE1000)
+	}
+	return false
+}
+
+// isHighEscape reports whether s starts with the escape of a non-ASCII byte.
+func isHighEscape(s []byte) bool {
+	return len(s) >= 3 && s[0] == '%' && ishex(s[1]) && ishex(s[2]) && unhex(s[1]) >= 8
+}
+
+// hostSpan returns the bounds of the host[:port] part of rawurl,
+// which are both zero if rawurl has no authority.
+func hostSpan(rawurl []byte) (start, end int) {
+	_, rest, err := getscheme(rawurl)
+	if err != nil || !bytes.HasPrefix(rest, DoubleSlash) {
+		return 0, 0
+	}
+	start = len(rawurl) - len(rest) + 2
+	authority := rawurl[start:]
+	if i := bytes.IndexAny(authority, "/?#"); i >= 0 {
+		authority = authority[:i]
+	}
+	end = start + len(authority)
+	if i := bytes.LastIndexByte(authority, '@'); i >= 0 {
+		start += i + 1
+	}
+	return start, end
+}
+
+// invalidUTF8Index returns the offset in s of the first sequence that
+// is not valid UTF-8 once percent-decoded, or -1 if there is none.
+// Malformed escapes are taken literally.
+func invalidUTF8Index(s []byte) int {
+	var buf [utf8.UTFMax]byte
+	n, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		c, at := s[i], i
+		if c == '%' && i+2 < len(s) && ishex(s[i+1]) && ishex(s[i+2]) {
+			c = unhex(s[i+1])<<4 | unhex(s[i+2])
+			i += 2
+		}
+		if n == 0 {
+			if c < utf8.RuneSelf {
+				continue
+			}
+			start = at
+		}
+		buf[n] = c
+		n++
+		if utf8.FullRune(buf[:n]) {
+			if r, size := utf8.DecodeRune(buf[:n]); r == utf8.RuneError && size == 1 {
+				return start
+			}
+			n = 0
+		}
+	}
+	if n > 0 {
+		return start
+	}
+	return -1
+}
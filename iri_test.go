@@ -0,0 +1,115 @@
+package bytesurl
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+var iriTests = []struct {
+	iri, uri string
+}{
+	{"http://example.com/", "http://example.com/"},
+	{"http://example.com/путь?q=значение#фрагмент", "http://example.com/%D0%BF%D1%83%D1%82%D1%8C?q=%D0%B7%D0%BD%D0%B0%D1%87%D0%B5%D0%BD%D0%B8%D0%B5#%D1%84%D1%80%D0%B0%D0%B3%D0%BC%D0%B5%D0%BD%D1%82"},
+	{"https://bücher.example:8080/a?emoji=😀", "https://xn--bcher-kva.example:8080/a?emoji=%F0%9F%98%80"},
+	{"http://us€r@bücher.example/", "http://us%E2%82%ACr@xn--bcher-kva.example/"},
+	{"http://example.com/a%2Fb/ü", "http://example.com/a%2Fb/%C3%BC"},
+	{"mailto:jörg@example.com", "mailto:j%C3%B6rg@example.com"},
+	{"/relative/ü", "/relative/%C3%BC"},
+	{"http://аааааа/", "http://xn--80aaaaaa/"},
+}
+
+func TestIRIToURI(t *testing.T) {
+	for _, tt := range iriTests {
+		uri, err := IRIToURI([]byte(tt.iri))
+		if err != nil || string(uri) != tt.uri {
+			t.Errorf("IRIToURI(%q) = %q, %v; want %q", tt.iri, uri, err, tt.uri)
+		}
+		if iri := URIToIRI([]byte(tt.uri)); string(iri) != tt.iri {
+			t.Errorf("URIToIRI(%q) = %q; want %q", tt.uri, iri, tt.iri)
+		}
+	}
+	if _, err := IRIToURI([]byte("http://example.com/\xff")); err != ErrInvalidUTF8 {
+		t.Errorf("IRIToURI of invalid UTF-8 returned %v; want %v", err, ErrInvalidUTF8)
+	}
+}
+
+var uriToIRIInvalidTests = []struct {
+	uri, iri string
+}{
+	{"http://example.com/%FF", "http://example.com/%FF"},
+	{"http://example.com/%C3", "http://example.com/%C3"},
+	{"http://example.com/%C3%28", "http://example.com/%C3%28"},
+	{"http://example.com/%E2%82", "http://example.com/%E2%82"},
+	{"http://example.com/%c3%bc%2f", "http://example.com/ü%2f"},
+	{"http://xn--zz.example/", "http://xn--zz.example/"},
+
+	// Characters an IRI does not allow stay escaped.
+	{"http://example.com/%C2%85", "http://example.com/%C2%85"},
+	{"http://example.com/a%E2%80%AEtxt.exe", "http://example.com/a%E2%80%AEtxt.exe"},
+	{"http://example.com/%E2%80%8F%E2%81%A6", "http://example.com/%E2%80%8F%E2%81%A6"},
+	{"http://example.com/%EF%BF%BF%F3%A0%80%81", "http://example.com/%EF%BF%BF%F3%A0%80%81"},
+	{"http://example.com/%EE%80%80?q=%EE%80%80#%EE%80%80", "http://example.com/%EE%80%80?q=\ue000#%EE%80%80"},
+	{"http://example.com/%C2%A0%F0%9F%98%80", "http://example.com/\u00a0😀"},
+}
+
+func TestURIToIRIKeepsInvalid(t *testing.T) {
+	for _, tt := range uriToIRIInvalidTests {
+		if iri := URIToIRI([]byte(tt.uri)); string(iri) != tt.iri {
+			t.Errorf("URIToIRI(%q) = %q; want %q", tt.uri, iri, tt.iri)
+		}
+	}
+}
+
+func TestParseIRI(t *testing.T) {
+	u, err := ParseIRI([]byte("https://bücher.example/путь/ü%20x?q=😀#фрагмент"))
+	if err != nil {
+		t.Fatalf("ParseIRI returned error %v", err)
+	}
+	if string(u.Host) != "xn--bcher-kva.example" || string(u.Path) != "/путь/ü x" || string(u.Fragment) != "фрагмент" {
+		t.Errorf("ParseIRI: Host = %q, Path = %q, Fragment = %q", u.Host, u.Path, u.Fragment)
+	}
+	if got, want := u.Query().Get("q"), []byte("😀"); bytes.Compare(got, want) != 0 {
+		t.Errorf("ParseIRI: query q = %q; want %q", got, want)
+	}
+
+	_, err = ParseIRI([]byte("http://example.com/a%C3%28"))
+	if uerr, ok := err.(*Error); !ok || uerr.Err != ErrInvalidUTF8 || uerr.Component != ComponentPath || uerr.Offset != 20 {
+		t.Errorf("ParseIRI error = %#v; want %v in path at 20", err, ErrInvalidUTF8)
+	}
+}
+
+var validUTF8Tests = []struct {
+	in        string
+	component Component
+	offset    int
+}{
+	{"http://example.com/%C3%BC/ü/%E2%82%AC", 0, -1},
+	{"http://example.com/%EF%BF%BD", 0, -1},
+	{"http://example.com/\xff", ComponentPath, 19},
+	{"http://example.com/a%FF", ComponentPath, 20},
+	{"http://example.com/?q=%C3", ComponentQuery, 22},
+	{"http://example.com/?q=%C3x", ComponentQuery, 22},
+	{"http://us%E2%82@example.com/", ComponentUserinfo, 9},
+	{"http://example.com/#%ED%A0%80", ComponentFragment, 20},
+}
+
+func TestParseValidUTF8(t *testing.T) {
+	opts := ParseOptions{ValidUTF8: true}
+	for _, tt := range validUTF8Tests {
+		_, err := opts.Parse([]byte(tt.in))
+		if tt.offset < 0 {
+			if err != nil {
+				t.Errorf("Parse(%q) returned error %v", tt.in, err)
+			}
+			continue
+		}
+		uerr, ok := err.(*Error)
+		if !ok || !errors.Is(err, ErrInvalidUTF8) || uerr.Component != tt.component || uerr.Offset != tt.offset {
+			t.Errorf("Parse(%q) = %#v; want %v at %v %d", tt.in, err, ErrInvalidUTF8, tt.component, tt.offset)
+		}
+	}
+	if _, err := Parse([]byte("http://example.com/%FF")); err != nil {
+		t.Errorf("Parse without ValidUTF8 rejected invalid UTF-8: %v", err)
+	}
+}
@@ -0,0 +1,344 @@
+package bytesurl
+
+import (
+	"encoding"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors returned by MarshalValues and UnmarshalValues.
+var (
+	ErrMarshalSource   = errors.New("MarshalValues needs a struct or a non-nil pointer to one")
+	ErrUnmarshalTarget = errors.New("UnmarshalValues needs a non-nil pointer to a struct")
+	ErrUnsupportedType = errors.New("unsupported field type")
+
+	// ErrUnexportedEmbedded is returned by UnmarshalValues for a key
+	// bound inside a nil pointer to an unexported embedded struct,
+	// which it cannot allocate.
+	ErrUnexportedEmbedded = errors.New("cannot allocate nil pointer to unexported embedded struct")
+)
+
+// A FieldError reports the struct field, and the query key bound to
+// it, that MarshalValues or UnmarshalValues failed on.
+type FieldError struct {
+	Field string // path of the field from the outer struct, such as "Page.Limit"
+	Key   string // the query key, such as "page.limit"
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return "field " + e.Field + " (key " + strconv.Quote(e.Key) + "): " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *FieldError) Unwrap() error { return e.Err }
+
+var (
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	durationType        = reflect.TypeOf(time.Duration(0))
+)
+
+// UnmarshalValues stores the values in the struct pointed to by v.
+//
+// Each exported field is bound to the key given by its `url` struct
+// tag, or to the field name if the tag has no name; a tag of "-" skips
+// the field. The fields of an untagged embedded struct are bound as if
+// they were fields of v, those of any other struct field to keys
+// prefixed with the field's key and a '.'. Pointers to structs are
+// followed the same way, and allocated only when one of their keys is
+// present. Fields whose key is absent are left alone.
+//
+// Fields may be strings, []byte, bools, integers, floats,
+// time.Duration, or implement encoding.TextUnmarshaler, as time.Time
+// does, or be pointers to these, which are allocated as needed. A
+// slice of these collects the repeated values of a key; any other
+// field takes the first value.
+//
+// The first field that fails is reported as a *FieldError.
+func UnmarshalValues(values Values, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return ErrUnmarshalTarget
+	}
+	root := rv.Elem()
+	return boundFields(root.Type(), "", "", func(bool) reflect.Value { return root }, func(f boundField) error {
+		vs := values[f.key]
+		if len(vs) == 0 {
+			return nil
+		}
+		v := f.value(true)
+		if !v.IsValid() {
+			return &FieldError{f.path, f.key, ErrUnexportedEmbedded}
+		}
+		if err := unmarshalField(v, vs); err != nil {
+			return &FieldError{f.path, f.key, err}
+		}
+		return nil
+	})
+}
+
+// MarshalValues returns the values of the fields of v, a struct or a
+// pointer to one, bound to keys as UnmarshalValues does. A field with
+// the omitempty tag option, as in `url:"limit,omitempty"`, is skipped
+// if it has its zero value, as are nil pointers, the fields of nil
+// pointers to structs and empty slices.
+// Floats use the shortest representation and encoding.TextMarshaler
+// takes precedence over the kind of the field.
+func MarshalValues(v interface{}) (Values, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, ErrMarshalSource
+	}
+	values := make(Values)
+	err := boundFields(rv.Type(), "", "", func(bool) reflect.Value { return rv }, func(f boundField) error {
+		v := f.value(false)
+		if !v.IsValid() || f.omitEmpty && v.IsZero() {
+			return nil
+		}
+		if err := marshalField(values, f.key, v); err != nil {
+			return &FieldError{f.path, f.key, err}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// A boundField is a struct field bound to a query key.
+type boundField struct {
+	path, key string
+	omitEmpty bool
+
+	// value returns the field. The nil pointers to structs on the way
+	// to it are allocated if alloc is set; otherwise, or if they cannot
+	// be set, value returns the zero Value.
+	value func(alloc bool) reflect.Value
+}
+
+// boundFields calls fn with each field of the struct type t bound to a
+// key, descending into nested structs and pointers to structs, and
+// stops at the first error. path and prefix are those of the struct
+// itself, which get returns as boundField.value does.
+func boundFields(t reflect.Type, path, prefix string, get func(alloc bool) reflect.Value, fn func(boundField) error) error {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("url")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if j := strings.IndexByte(tag, ','); j >= 0 {
+			name, opts = tag[:j], tag[j+1:]
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fieldPath := sf.Name
+		if path != "" {
+			fieldPath = path + "." + sf.Name
+		}
+		ft, ptr := sf.Type, false
+		if ft.Kind() == reflect.Ptr && ft.Elem().Kind() == reflect.Struct && !isTextType(ft.Elem()) {
+			ft, ptr = ft.Elem(), true
+		}
+		field := fieldGetter(get, i, ptr)
+		if ft.Kind() == reflect.Struct && !isTextType(ft) {
+			// The exported fields of an unexported embedded struct
+			// are still promoted, so only its own export is ignored.
+			if sf.PkgPath != "" && !sf.Anonymous {
+				continue
+			}
+			p := prefix
+			if !sf.Anonymous || tag != "" {
+				p = prefix + name + "."
+			}
+			if err := boundFields(ft, fieldPath, p, field, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if sf.PkgPath != "" || sf.Anonymous {
+			continue
+		}
+		omitEmpty := strings.Contains(","+opts+",", ",omitempty,")
+		if err := fn(boundField{fieldPath, prefix + name, omitEmpty, field}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldGetter returns a getter, as described by boundField.value, of
+// field i of the struct that get returns. If ptr is set the field is a
+// pointer to a struct, and the getter returns the struct it points to.
+func fieldGetter(get func(bool) reflect.Value, i int, ptr bool) func(bool) reflect.Value {
+	return func(alloc bool) reflect.Value {
+		v := get(alloc)
+		if !v.IsValid() {
+			return v
+		}
+		v = v.Field(i)
+		if !ptr {
+			return v
+		}
+		if v.IsNil() {
+			if !alloc || !v.CanSet() {
+				return reflect.Value{}
+			}
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return v.Elem()
+	}
+}
+
+// isTextType reports whether values of t are encoded as text, rather
+// than field by field if t is a struct or element by element if t is
+// a slice.
+func isTextType(t reflect.Type) bool {
+	return t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+// isRepeated reports whether a field of type t holds repeated values.
+func isRepeated(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8 && !isTextType(t)
+}
+
+func unmarshalField(v reflect.Value, vs [][]byte) error {
+	if !isRepeated(v.Type()) {
+		return unmarshalValue(v, vs[0])
+	}
+	s := reflect.MakeSlice(v.Type(), len(vs), len(vs))
+	for i, b := range vs {
+		if err := unmarshalValue(s.Index(i), b); err != nil {
+			return err
+		}
+	}
+	v.Set(s)
+	return nil
+}
+
+// unmarshalValue stores b in v, which must be addressable.
+func unmarshalValue(v reflect.Value, b []byte) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return unmarshalValue(v.Elem(), b)
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText(b)
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(string(b))
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(string(b))
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return ErrUnsupportedType
+		}
+		v.SetBytes(append([]byte(nil), b...))
+	case reflect.Bool:
+		x, err := strconv.ParseBool(string(b))
+		if err != nil {
+			return err
+		}
+		v.SetBool(x)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x, err := strconv.ParseInt(string(b), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(x)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		x, err := strconv.ParseUint(string(b), 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(x)
+	case reflect.Float32, reflect.Float64:
+		x, err := strconv.ParseFloat(string(b), v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(x)
+	default:
+		return ErrUnsupportedType
+	}
+	return nil
+}
+
+func marshalField(values Values, key string, v reflect.Value) error {
+	if !isRepeated(v.Type()) {
+		b, ok, err := marshalValue(v)
+		if ok {
+			values.Add(key, b)
+		}
+		return err
+	}
+	for i := 0; i < v.Len(); i++ {
+		b, ok, err := marshalValue(v.Index(i))
+		if err != nil {
+			return err
+		}
+		if ok {
+			values.Add(key, b)
+		}
+	}
+	return nil
+}
+
+// marshalValue returns the encoding of v. ok is false if v is a nil
+// pointer, which has none.
+func marshalValue(v reflect.Value) (b []byte, ok bool, err error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, false, nil
+		}
+		return marshalValue(v.Elem())
+	}
+	if v.Type().Implements(textMarshalerType) {
+		b, err = v.Interface().(encoding.TextMarshaler).MarshalText()
+		return b, err == nil, err
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(textMarshalerType) {
+		b, err = v.Addr().Interface().(encoding.TextMarshaler).MarshalText()
+		return b, err == nil, err
+	}
+	if v.Type() == durationType {
+		return []byte(time.Duration(v.Int()).String()), true, nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return []byte(v.String()), true, nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return nil, false, ErrUnsupportedType
+		}
+		return v.Bytes(), true, nil
+	case reflect.Bool:
+		return strconv.AppendBool(nil, v.Bool()), true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.AppendInt(nil, v.Int(), 10), true, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.AppendUint(nil, v.Uint(), 10), true, nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.AppendFloat(nil, v.Float(), 'g', -1, v.Type().Bits()), true, nil
+	}
+	return nil, false, ErrUnsupportedType
+}
@@ -0,0 +1,192 @@
+package bytesurl
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type Page struct {
+	Limit  int    `url:"limit"`
+	Cursor []byte `url:"cursor,omitempty"`
+}
+
+type embedded struct {
+	Trace bool `url:"trace,omitempty"`
+}
+
+type searchRequest struct {
+	Query   string        `url:"q"`
+	Tags    []string      `url:"tag,omitempty"`
+	Score   *float64      `url:"score"`
+	Ratio   float32       `url:"ratio,omitempty"`
+	Offset  uint16        `url:"offset,omitempty"`
+	Since   time.Time     `url:"since,omitempty"`
+	Timeout time.Duration `url:"timeout,omitempty"`
+	Page    Page          `url:"page"`
+	Secret  string        `url:"-"`
+	Raw     string
+	embedded
+	ignored int
+}
+
+func TestUnmarshalValues(t *testing.T) {
+	values, _ := ParseQuery([]byte("q=go+url&tag=a&tag=b&score=0.5&ratio=2&offset=7&since=2024-02-29T12:00:00Z&timeout=1m30s&page.limit=20&page.cursor=xyz&Raw=r&trace=true&Secret=s&ignored=1"))
+	var got searchRequest
+	if err := UnmarshalValues(values, &got); err != nil {
+		t.Fatalf("UnmarshalValues returned error %v", err)
+	}
+	score := 0.5
+	want := searchRequest{
+		Query:    "go url",
+		Tags:     []string{"a", "b"},
+		Score:    &score,
+		Ratio:    2,
+		Offset:   7,
+		Since:    time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC),
+		Timeout:  90 * time.Second,
+		Page:     Page{20, []byte("xyz")},
+		Raw:      "r",
+		embedded: embedded{Trace: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("UnmarshalValues = %+v, want %+v", got, want)
+	}
+
+	got = searchRequest{Query: "kept"}
+	if err := UnmarshalValues(Values{}, &got); err != nil || got.Query != "kept" || got.Score != nil {
+		t.Errorf("UnmarshalValues of no values = %+v, %v", got, err)
+	}
+}
+
+var unmarshalErrorTests = []struct {
+	query string
+	field string
+	key   string
+	err   error
+}{
+	{"page.limit=ten", "Page.Limit", "page.limit", strconv.ErrSyntax},
+	{"offset=70000", "Offset", "offset", strconv.ErrRange},
+	{"trace=maybe", "embedded.Trace", "trace", strconv.ErrSyntax},
+	{"tag=a&score=x", "Score", "score", strconv.ErrSyntax},
+}
+
+func TestUnmarshalValuesErrors(t *testing.T) {
+	for _, tt := range unmarshalErrorTests {
+		values, _ := ParseQuery([]byte(tt.query))
+		err := UnmarshalValues(values, &searchRequest{})
+		var ferr *FieldError
+		if !errors.As(err, &ferr) || ferr.Field != tt.field || ferr.Key != tt.key || !errors.Is(err, tt.err) {
+			t.Errorf("UnmarshalValues(%q) error = %v; want %v on %s (key %q)", tt.query, err, tt.err, tt.field, tt.key)
+		}
+	}
+
+	var unsupported struct {
+		M map[string]string `url:"m"`
+	}
+	err := UnmarshalValues(Values{"m": {[]byte("x")}}, &unsupported)
+	if !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("UnmarshalValues into a map returned %v; want %v", err, ErrUnsupportedType)
+	}
+	for _, v := range []interface{}{nil, searchRequest{}, (*searchRequest)(nil), new(int)} {
+		if err := UnmarshalValues(Values{}, v); err != ErrUnmarshalTarget {
+			t.Errorf("UnmarshalValues(%T) returned %v; want %v", v, err, ErrUnmarshalTarget)
+		}
+	}
+}
+
+func TestMarshalValues(t *testing.T) {
+	score := 0.25
+	in := searchRequest{
+		Query:   "go url",
+		Tags:    []string{"a", "b"},
+		Score:   &score,
+		Since:   time.Date(2024, 2, 29, 12, 0, 0, 0, time.UTC),
+		Timeout: 2 * time.Second,
+		Page:    Page{Limit: 10},
+		Secret:  "s",
+	}
+	values, err := MarshalValues(&in)
+	if err != nil {
+		t.Fatalf("MarshalValues returned error %v", err)
+	}
+	const want = "Raw=&page.limit=10&q=go+url&score=0.25&since=2024-02-29T12%3A00%3A00Z&tag=a&tag=b&timeout=2s"
+	if got := values.Encode(); got != want {
+		t.Errorf("MarshalValues(...).Encode() = %q, want %q", got, want)
+	}
+
+	var back searchRequest
+	if err := UnmarshalValues(values, &back); err != nil {
+		t.Fatalf("UnmarshalValues returned error %v", err)
+	}
+	in.Secret = ""
+	if !reflect.DeepEqual(back, in) {
+		t.Errorf("round trip = %+v, want %+v", back, in)
+	}
+
+	if _, err := MarshalValues(in); err != nil {
+		t.Errorf("MarshalValues of a struct value returned error %v", err)
+	}
+	var unsupported struct {
+		C chan int `url:"c"`
+	}
+	_, err = MarshalValues(unsupported)
+	var ferr *FieldError
+	if !errors.As(err, &ferr) || ferr.Field != "C" || !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("MarshalValues of a chan returned %v; want %v", err, ErrUnsupportedType)
+	}
+	if _, err := MarshalValues(42); err != ErrMarshalSource {
+		t.Errorf("MarshalValues(42) returned %v; want %v", err, ErrMarshalSource)
+	}
+}
+
+type Sort struct {
+	By   string `url:"by"`
+	Desc bool   `url:"desc,omitempty"`
+}
+
+type listRequest struct {
+	*Sort
+	Filter *Page `url:"filter"`
+	Next   *Page `url:"next"`
+}
+
+func TestValuesStructPointers(t *testing.T) {
+	in := listRequest{Sort: &Sort{By: "name", Desc: true}, Filter: &Page{Limit: 5}}
+	values, err := MarshalValues(in)
+	if err != nil {
+		t.Fatalf("MarshalValues returned error %v", err)
+	}
+	const want = "by=name&desc=true&filter.limit=5"
+	if got := values.Encode(); got != want {
+		t.Errorf("MarshalValues(...).Encode() = %q, want %q", got, want)
+	}
+	if values, err := MarshalValues(listRequest{}); err != nil || len(values) != 0 {
+		t.Errorf("MarshalValues with nil pointers = %q, %v; want no values", values.Encode(), err)
+	}
+
+	var back listRequest
+	if err := UnmarshalValues(values, &back); err != nil {
+		t.Fatalf("UnmarshalValues returned error %v", err)
+	}
+	if !reflect.DeepEqual(back, in) {
+		t.Errorf("round trip = %+v, want %+v", back, in)
+	}
+	if back.Next != nil {
+		t.Errorf("UnmarshalValues allocated %+v for absent keys", back.Next)
+	}
+
+	var hidden struct {
+		*embedded
+	}
+	err = UnmarshalValues(Values{"trace": {[]byte("true")}}, &hidden)
+	if !errors.Is(err, ErrUnexportedEmbedded) {
+		t.Errorf("UnmarshalValues into a nil unexported embedded pointer returned %v; want %v", err, ErrUnexportedEmbedded)
+	}
+	hidden.embedded = &embedded{}
+	if err := UnmarshalValues(Values{"trace": {[]byte("true")}}, &hidden); err != nil || !hidden.Trace {
+		t.Errorf("UnmarshalValues into an unexported embedded pointer = %+v, %v", hidden.embedded, err)
+	}
+}
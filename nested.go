@@ -0,0 +1,270 @@
+package bytesurl
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Errors returned when decoding nested query parameters.
+var (
+	ErrNestedDepth    = errors.New("query key nested too deeply")
+	ErrNestedWidth    = errors.New("too many children in nested query key")
+	ErrNestedConflict = errors.New("conflicting nesting of query key")
+)
+
+// A NodeKind is the kind of a Node.
+type NodeKind int
+
+// The kinds of Node.
+const (
+	NodeValue NodeKind = iota // a leaf holding Value
+	NodeMap                   // a set of named children in Map
+	NodeList                  // an ordered list of children in List
+)
+
+// A Node is a node of the tree of nested query parameters written in
+// the bracket syntax of Rails and PHP, where
+//
+//	filter[status][]=open&filter[status][]=closed&filter[owner]=me
+//
+// is the map {filter: {status: [open, closed], owner: me}}.
+type Node struct {
+	Kind  NodeKind
+	Value []byte
+	Map   map[string]*Node
+	List  []*Node
+}
+
+func newNode(kind NodeKind) *Node {
+	n := &Node{Kind: kind}
+	if kind == NodeMap {
+		n.Map = make(map[string]*Node)
+	}
+	return n
+}
+
+// Default limits of NestedOptions.
+const (
+	DefaultMaxNestedDepth = 32
+	DefaultMaxNestedWidth = 1000
+)
+
+// NestedOptions limits the tree built from nested query parameters, so
+// that a hostile query cannot make the decoder allocate without bounds.
+type NestedOptions struct {
+	// MaxDepth is the maximum number of bracketed segments in a key.
+	// Zero means DefaultMaxNestedDepth.
+	MaxDepth int
+
+	// MaxWidth is the maximum number of children of any node,
+	// including the root. Zero means DefaultMaxNestedWidth.
+	MaxWidth int
+}
+
+// DecodeNested decodes v into a tree with the default NestedOptions.
+func DecodeNested(v Values) (*Node, error) {
+	return NestedOptions{}.Decode(v)
+}
+
+// Decode decodes v into a tree, whose root is a NodeMap.
+//
+// In a key such as a[b][], the name a and each bracketed segment go
+// one level down: a non-empty segment names a child of a NodeMap, an
+// empty one appends a child to a NodeList. A key that is not in this
+// form, such as a[b or [a], is a plain name. When a list element is a
+// map, as in a[][b], the pair goes into the last element unless that
+// already holds the name, b here, which starts a new element. Of the
+// repeated values of a key that does not end in [], the last wins.
+// Within a name or segment, "%5B", "%5D" and "%25" stand for '[', ']'
+// and '%', which is how EncodeNested writes them.
+//
+// Values does not record the order of the keys, so Decode takes them
+// in sorted order; use DecodeOrdered where lists of maps depend on the
+// order of the query. Keys whose nesting conflicts, as a=1&a[b]=2,
+// and keys past the limits of o fail the decoding.
+func (o NestedOptions) Decode(v Values) (*Node, error) {
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	d := o.decoder()
+	for _, k := range keys {
+		for _, value := range v[k] {
+			if err := d.insert(k, value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return d.root, nil
+}
+
+// DecodeOrdered is like Decode, but takes the pairs of v in order.
+func (o NestedOptions) DecodeOrdered(v OrderedValues) (*Node, error) {
+	d := o.decoder()
+	for _, p := range v {
+		if err := d.insert(p.Key, p.Value); err != nil {
+			return nil, err
+		}
+	}
+	return d.root, nil
+}
+
+type nestedDecoder struct {
+	root            *Node
+	maxDepth, width int
+	segs            []string
+}
+
+func (o NestedOptions) decoder() *nestedDecoder {
+	d := &nestedDecoder{root: newNode(NodeMap), maxDepth: o.MaxDepth, width: o.MaxWidth}
+	if d.maxDepth <= 0 {
+		d.maxDepth = DefaultMaxNestedDepth
+	}
+	if d.width <= 0 {
+		d.width = DefaultMaxNestedWidth
+	}
+	return d
+}
+
+// insert adds the value of key to the tree.
+func (d *nestedDecoder) insert(key string, value []byte) error {
+	segs, err := d.split(key)
+	if err != nil {
+		return err
+	}
+	n := d.root
+	for i, seg := range segs {
+		last := i == len(segs)-1
+		kind := NodeValue
+		if !last {
+			kind = NodeMap
+			if segs[i+1] == "" {
+				kind = NodeList
+			}
+		}
+		var child *Node
+		if i > 0 && seg == "" {
+			if kind == NodeMap && len(n.List) > 0 {
+				if l := n.List[len(n.List)-1]; l.Kind == NodeMap && l.Map[segs[i+1]] == nil {
+					n = l
+					continue
+				}
+			}
+			if len(n.List) >= d.width {
+				return nestedError(ErrNestedWidth, key)
+			}
+			child = newNode(kind)
+			n.List = append(n.List, child)
+		} else if child = n.Map[seg]; child == nil {
+			if len(n.Map) >= d.width {
+				return nestedError(ErrNestedWidth, key)
+			}
+			child = newNode(kind)
+			n.Map[seg] = child
+		} else if child.Kind != kind {
+			return nestedError(ErrNestedConflict, key)
+		}
+		if last {
+			child.Value = value
+		}
+		n = child
+	}
+	return nil
+}
+
+// split returns the name and the bracketed segments of key, or key
+// alone if it is not in bracket syntax. The result is only valid until
+// the next call.
+func (d *nestedDecoder) split(key string) ([]string, error) {
+	d.segs = d.segs[:0]
+	i := strings.IndexByte(key, '[')
+	if i <= 0 {
+		return append(d.segs, unescapeNestedKey(key)), nil
+	}
+	d.segs = append(d.segs, unescapeNestedKey(key[:i]))
+	for rest := key[i:]; len(rest) > 0; {
+		j := strings.IndexByte(rest, ']')
+		if rest[0] != '[' || j < 0 {
+			return append(d.segs[:0], unescapeNestedKey(key)), nil
+		}
+		if len(d.segs) > d.maxDepth {
+			return nil, nestedError(ErrNestedDepth, key)
+		}
+		d.segs = append(d.segs, unescapeNestedKey(rest[1:j]))
+		rest = rest[j+1:]
+	}
+	return d.segs, nil
+}
+
+var (
+	nestedKeyEscaper   = strings.NewReplacer("%", "%25", "[", "%5B", "]", "%5D")
+	nestedKeyUnescaper = strings.NewReplacer("%25", "%", "%5B", "[", "%5D", "]", "%5b", "[", "%5d", "]")
+)
+
+// escapeNestedKey escapes the brackets in a name or segment, and '%'
+// so that the escapes can be told from the name itself.
+func escapeNestedKey(s string) string {
+	if strings.IndexAny(s, "%[]") < 0 {
+		return s
+	}
+	return nestedKeyEscaper.Replace(s)
+}
+
+// unescapeNestedKey reverses escapeNestedKey.
+func unescapeNestedKey(s string) string {
+	if strings.IndexByte(s, '%') < 0 {
+		return s
+	}
+	return nestedKeyUnescaper.Replace(s)
+}
+
+func nestedError(err error, key string) error {
+	return fmt.Errorf("%w %s", err, strconv.Quote(key))
+}
+
+// EncodeNested flattens the tree below root, a NodeMap, into pairs
+// with bracketed keys, in an order that DecodeOrdered turns back into
+// the same tree. Map keys are sorted, and the brackets and '%' in them
+// are escaped as "%5B", "%5D" and "%25". Empty maps and lists have no
+// pairs and are lost, and so is the boundary between consecutive maps
+// in a list whose names do not repeat, as in Rails. A nil root has no
+// pairs.
+func EncodeNested(root *Node) OrderedValues {
+	var v OrderedValues
+	if root == nil {
+		return v
+	}
+	for _, k := range sortedKeys(root.Map) {
+		v = appendNested(v, escapeNestedKey(k), root.Map[k])
+	}
+	return v
+}
+
+func appendNested(v OrderedValues, key string, n *Node) OrderedValues {
+	switch n.Kind {
+	case NodeMap:
+		for _, k := range sortedKeys(n.Map) {
+			v = appendNested(v, key+"["+escapeNestedKey(k)+"]", n.Map[k])
+		}
+	case NodeList:
+		for _, child := range n.List {
+			v = appendNested(v, key+"[]", child)
+		}
+	default:
+		v = append(v, QueryPair{key, n.Value})
+	}
+	return v
+}
+
+func sortedKeys(m map[string]*Node) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,144 @@
+package bytesurl
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// nodeString renders n compactly for comparisons, with sorted map keys.
+func nodeString(n *Node) string {
+	switch n.Kind {
+	case NodeMap:
+		var parts []string
+		for k, child := range n.Map {
+			parts = append(parts, k+":"+nodeString(child))
+		}
+		sort.Strings(parts)
+		return "{" + strings.Join(parts, " ") + "}"
+	case NodeList:
+		var parts []string
+		for _, child := range n.List {
+			parts = append(parts, nodeString(child))
+		}
+		return "[" + strings.Join(parts, " ") + "]"
+	}
+	return string(n.Value)
+}
+
+var nestedTests = []struct {
+	query string
+	tree  string
+}{
+	{"filter[status][]=open&filter[status][]=closed&filter[owner]=me", "{filter:{owner:me status:[open closed]}}"},
+	{"a=1&a=2&b[c][d]=3", "{a:2 b:{c:{d:3}}}"},
+	{"items[][id]=1&items[][qty]=2&items[][id]=3", "{items:[{id:1 qty:2} {id:3}]}"},
+	{"m[][]=1&m[][]=2", "{m:[[1] [2]]}"},
+	{"a[b=1&[c]=2&d[e]f=3&g[]=&h[x", "{[c]:2 a[b:1 d[e]f:3 g:[] h[x:}"},
+	{"x[y][z]=%26&x[w]", "{x:{w: y:{z:&}}}"},
+}
+
+func TestDecodeNested(t *testing.T) {
+	for _, tt := range nestedTests {
+		v, err := ParseQueryOrdered([]byte(tt.query))
+		if err != nil {
+			t.Fatalf("ParseQueryOrdered(%q) returned error %v", tt.query, err)
+		}
+		tree, err := NestedOptions{}.DecodeOrdered(v)
+		if err != nil {
+			t.Errorf("DecodeOrdered(%q) returned error %v", tt.query, err)
+			continue
+		}
+		if got := nodeString(tree); got != tt.tree {
+			t.Errorf("DecodeOrdered(%q) = %s, want %s", tt.query, got, tt.tree)
+		}
+		back, err := NestedOptions{}.DecodeOrdered(EncodeNested(tree))
+		if err != nil || nodeString(back) != tt.tree {
+			t.Errorf("EncodeNested(%s) decodes to %s, %v", tt.tree, nodeString(back), err)
+		}
+	}
+
+	values, _ := ParseQuery([]byte("filter[status][]=open&filter[owner]=me"))
+	tree, err := DecodeNested(values)
+	if got, want := nodeString(tree), "{filter:{owner:me status:[open]}}"; err != nil || got != want {
+		t.Errorf("DecodeNested = %s, %v; want %s", got, err, want)
+	}
+}
+
+func TestEncodeNested(t *testing.T) {
+	v, _ := ParseQueryOrdered([]byte("z=1&filter[status][]=open&filter[status][]=closed&filter[owner]=me&a[][b]=2"))
+	tree, err := NestedOptions{}.DecodeOrdered(v)
+	if err != nil {
+		t.Fatalf("DecodeOrdered returned error %v", err)
+	}
+	const want = "a%5B%5D%5Bb%5D=2&filter%5Bowner%5D=me&filter%5Bstatus%5D%5B%5D=open&filter%5Bstatus%5D%5B%5D=closed&z=1"
+	if got := EncodeNested(tree).Encode(); got != want {
+		t.Errorf("EncodeNested(...).Encode() = %q, want %q", got, want)
+	}
+}
+
+func TestDecodeNestedErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		opts  NestedOptions
+		err   error
+	}{
+		{"a=1&a[b]=2", NestedOptions{}, ErrNestedConflict},
+		{"a[b]=1&a[]=2", NestedOptions{}, ErrNestedConflict},
+		{"a[]=1&a[b]=2", NestedOptions{}, ErrNestedConflict},
+		{"a[b][c]=1", NestedOptions{MaxDepth: 1}, ErrNestedDepth},
+		{"a" + strings.Repeat("[]", DefaultMaxNestedDepth+1) + "=1", NestedOptions{}, ErrNestedDepth},
+		{"a[]=1&a[]=2&a[]=3", NestedOptions{MaxWidth: 2}, ErrNestedWidth},
+		{"a[x]=1&a[y]=2&a[z]=3", NestedOptions{MaxWidth: 2}, ErrNestedWidth},
+		{"a=1&b=2&c=3", NestedOptions{MaxWidth: 2}, ErrNestedWidth},
+	}
+	for _, tt := range tests {
+		v, _ := ParseQueryOrdered([]byte(tt.query))
+		if _, err := tt.opts.DecodeOrdered(v); !errors.Is(err, tt.err) {
+			t.Errorf("DecodeOrdered(%q) with %+v returned %v; want %v", tt.query, tt.opts, err, tt.err)
+		}
+	}
+	deep := "a" + strings.Repeat("[]", DefaultMaxNestedDepth)
+	if _, err := DecodeNested(Values{deep: {[]byte("1")}}); err != nil {
+		t.Errorf("DecodeNested at the default depth limit returned %v", err)
+	}
+	wide := make(Values)
+	for i := 0; i < DefaultMaxNestedWidth; i++ {
+		wide.Add(fmt.Sprintf("k[%d]", i), []byte("v"))
+	}
+	if _, err := DecodeNested(wide); err != nil {
+		t.Errorf("DecodeNested at the default width limit returned %v", err)
+	}
+}
+
+func TestEncodeNestedEscapesKeys(t *testing.T) {
+	leaf := func(s string) *Node { return &Node{Kind: NodeValue, Value: []byte(s)} }
+	tree := &Node{Kind: NodeMap, Map: map[string]*Node{
+		"a[b]": leaf("1"),
+		"[":    leaf("2"),
+		"100%": leaf("3"),
+		"m": {Kind: NodeMap, Map: map[string]*Node{
+			"x]y":   leaf("4"),
+			"%5B":   leaf("5"),
+			"l[]":   {Kind: NodeList, List: []*Node{leaf("6"), leaf("7")}},
+			"plain": leaf("8"),
+		}},
+	}}
+	v, err := ParseQueryOrdered([]byte(EncodeNested(tree).Encode()))
+	if err != nil {
+		t.Fatalf("ParseQueryOrdered returned error %v", err)
+	}
+	back, err := NestedOptions{}.DecodeOrdered(v)
+	if err != nil {
+		t.Fatalf("DecodeOrdered returned error %v", err)
+	}
+	if got := nodeString(back); got != nodeString(tree) {
+		t.Errorf("EncodeNested round trip = %s, want %s", got, nodeString(tree))
+	}
+
+	if v := EncodeNested(nil); len(v) != 0 {
+		t.Errorf("EncodeNested(nil) = %v, want no pairs", v)
+	}
+}
@@ -0,0 +1,177 @@
+package bytesurl
+
+import "bytes"
+
+// ParseOptions controls how a URL is parsed. The zero value parses
+// exactly like the package-level Parse, ParseInto and ParseRequestURI.
+type ParseOptions struct {
+	// Strict rejects any input that does not match the URI-reference
+	// grammar of RFC 3986 Appendix A, such as spaces in hosts, raw '['
+	// in paths or non-ASCII bytes anywhere.
+	Strict bool
+
+	// IDNA converts internationalized host names to their ASCII
+	// A-label form with ToASCII, so that "bücher.example" is stored
+	// in URL.Host as "xn--bcher-kva.example".
+	IDNA bool
+
+	// TrimSpace strips leading and trailing C0 control or space
+	// characters before parsing, as browsers do with pasted URLs.
+	// Control characters inside the URL are still rejected.
+	TrimSpace bool
+
+	// InPlace unescapes the userinfo, the path and the fragment into
+	// rawurl itself instead of allocating, so rawurl is modified. A
+	// path or fragment whose escaping differs from the default one is
+	// still copied, as its original form is kept in RawPath or
+	// RawFragment.
+	//
+	// rawurl is only written once the whole URL has parsed. If parsing
+	// fails, rawurl holds exactly what was passed in, which the Error
+	// quotes and locates, so the caller can retry with it.
+	InPlace bool
+
+	// ValidUTF8 rejects input that is not valid UTF-8 once
+	// percent-decoded with ErrInvalidUTF8.
+	ValidUTF8 bool
+
+	// Lenient decodes the userinfo, the path and the fragment the way
+	// browsers do: a '%' that does not start a valid escape is kept
+	// literally instead of failing the parse. The original form stays
+	// available through EscapedPath and EscapedFragment, and the number
+	// of invalid escapes in URL.InvalidEscapes.
+	Lenient bool
+}
+
+// ParseStrict parses rawurl like Parse, but rejects any input the
+// RFC 3986 grammar does not allow. It is a shorthand for
+// ParseOptions{Strict: true}.Parse(rawurl).
+func ParseStrict(rawurl []byte) (*URL, error) {
+	return ParseOptions{Strict: true}.Parse(rawurl)
+}
+
+// Parse parses rawurl into a URL structure according to o.
+// The rawurl may be relative or absolute.
+func (o ParseOptions) Parse(rawurl []byte) (*URL, error) {
+	url := new(URL)
+	if err := o.ParseInto(url, rawurl); err != nil {
+		return nil, err
+	}
+	return url, nil
+}
+
+// ParseInto is like Parse but stores the result in dst, see the
+// package-level ParseInto.
+func (o ParseOptions) ParseInto(dst *URL, rawurl []byte) error {
+	if err := o.validate(&rawurl); err != nil {
+		return err
+	}
+	// Cut off #frag
+	u, frag := split(rawurl, FragmentByte, true)
+	if err := o.parse(dst, u, false); err != nil {
+		return err
+	}
+	if bytes.Equal(frag, EmptyByte) {
+		// A '#' with nothing after it is written back.
+		dst.ForceFragment = len(u) < len(rawurl)
+	} else if err := dst.setFragment(frag, &o); err != nil {
+		return parseError(rawurl, errorAt(ComponentFragment, len(u)+1, err))
+	}
+	dst.unescapePending()
+	return nil
+}
+
+// ParseRequestURI is like the package-level ParseRequestURI but
+// honours o.
+func (o ParseOptions) ParseRequestURI(rawurl []byte) (*URL, error) {
+	if err := o.validate(&rawurl); err != nil {
+		return nil, err
+	}
+	url := new(URL)
+	if err := o.parse(url, rawurl, true); err != nil {
+		return nil, err
+	}
+	url.unescapePending()
+	return url, nil
+}
+
+// validate trims *rawurl if o.TrimSpace is set and checks it for
+// control characters and, if o.ValidUTF8 or o.Strict is set, for
+// invalid UTF-8 or against RFC 3986.
+func (o *ParseOptions) validate(rawurl *[]byte) error {
+	if o.TrimSpace {
+		*rawurl = trimControlAndSpace(*rawurl)
+	}
+	err := validateControl(*rawurl)
+	if err == nil && o.ValidUTF8 {
+		if i := invalidUTF8Index(*rawurl); i >= 0 {
+			err = errorAt(componentAt(*rawurl, i), i, ErrInvalidUTF8)
+		}
+	}
+	if err == nil && o.Strict {
+		err = validateStrict(*rawurl)
+	}
+	if err != nil {
+		return parseError(*rawurl, err)
+	}
+	return nil
+}
+
+// The components of a URL that ParseOptions.InPlace unescapes over
+// rawurl, see unescapePending.
+const (
+	pendingUsername uint8 = 1 << iota
+	pendingPassword
+	pendingPath
+	pendingFragment
+)
+
+// unescape unescapes s, a component of u being parsed, according to o,
+// which may be nil. The invalid escapes kept by o.Lenient are added to
+// u.InvalidEscapes.
+//
+// If o.InPlace is set and pending names the component, s is only
+// checked and returned still escaped: it is unescaped over rawurl by
+// u.unescapePending once the whole URL has parsed, so that rawurl is
+// left intact when a later component fails.
+func (o *ParseOptions) unescape(u *URL, s []byte, mode Encoding, pending uint8) ([]byte, error) {
+	if o == nil {
+		return unescape(s, mode)
+	}
+	var t []byte
+	var err error
+	if o.InPlace && pending != 0 {
+		if _, _, err = countEscapes(s, mode); err == nil {
+			u.pending |= pending
+			return s, nil
+		}
+	} else {
+		t, err = unescape(s, mode)
+	}
+	if err != nil && o.Lenient {
+		var n int
+		t, n = unescapeLenient(s, mode)
+		u.InvalidEscapes += n
+		return t, nil
+	}
+	return t, err
+}
+
+// unescapePending unescapes over rawurl the components that
+// ParseOptions.unescape left escaped. They were checked then, so
+// unescaping cannot fail.
+func (u *URL) unescapePending() {
+	if u.pending&pendingUsername != 0 {
+		u.userinfo.username, _ = UnescapeInPlace(u.userinfo.username, EncodeUserPassword)
+	}
+	if u.pending&pendingPassword != 0 {
+		u.userinfo.password, _ = UnescapeInPlace(u.userinfo.password, EncodeUserPassword)
+	}
+	if u.pending&pendingPath != 0 {
+		u.Path, _ = UnescapeInPlace(u.Path, EncodePath)
+	}
+	if u.pending&pendingFragment != 0 {
+		u.Fragment, _ = UnescapeInPlace(u.Fragment, EncodeFragment)
+	}
+	u.pending = 0
+}
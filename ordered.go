@@ -0,0 +1,107 @@
+package bytesurl
+
+// A QueryPair is a key and one of its values.
+type QueryPair struct {
+	Key   string
+	Value []byte
+}
+
+// OrderedValues is a list of query parameters that, unlike Values,
+// keeps the pairs in the order they were parsed or added, duplicate
+// keys included. Encode writes them back in that order, which is
+// needed when the query is signed or otherwise compared byte for byte.
+type OrderedValues []QueryPair
+
+// ParseQueryOrdered parses the URL-encoded query string and returns its
+// pairs in order. Like ParseQuery, it always returns all the valid pairs
+// found; err describes the first decoding error encountered, if any.
+func ParseQueryOrdered(query []byte) (v OrderedValues, err error) {
+	err = parseQuery(query, v.Add)
+	return
+}
+
+// Get gets the first value associated with the given key. If there
+// are no values associated with the key, Get returns the empty string.
+func (v OrderedValues) Get(key string) []byte {
+	for _, p := range v {
+		if p.Key == key {
+			return p.Value
+		}
+	}
+	return EmptyByte
+}
+
+// Values returns all the values associated with the given key, in order.
+func (v OrderedValues) Values(key string) [][]byte {
+	var vs [][]byte
+	for _, p := range v {
+		if p.Key == key {
+			vs = append(vs, p.Value)
+		}
+	}
+	return vs
+}
+
+// Set sets the key to value. The first pair with the key keeps its
+// position and takes the value; the others are removed. If there is
+// none, the pair is added at the end.
+func (v *OrderedValues) Set(key string, value []byte) {
+	set := false
+	w := (*v)[:0]
+	for _, p := range *v {
+		if p.Key == key {
+			if set {
+				continue
+			}
+			p.Value, set = value, true
+		}
+		w = append(w, p)
+	}
+	if !set {
+		w = append(w, QueryPair{key, value})
+	}
+	*v = w
+}
+
+// Add adds the value to key, after all the other pairs.
+func (v *OrderedValues) Add(key string, value []byte) {
+	*v = append(*v, QueryPair{key, value})
+}
+
+// Del deletes the values associated with key.
+func (v *OrderedValues) Del(key string) {
+	w := (*v)[:0]
+	for _, p := range *v {
+		if p.Key != key {
+			w = append(w, p)
+		}
+	}
+	*v = w
+}
+
+// Encode encodes the pairs into URL-encoded form
+// ("foo=quux&bar=baz") in order.
+func (v OrderedValues) Encode() string {
+	buf := make([]byte, 0, v.EncodedLen())
+	for i, p := range v {
+		if i > 0 {
+			buf = append(buf, '&')
+		}
+		buf = appendEscape(buf, []byte(p.Key), EncodeQueryComponent)
+		buf = append(buf, '=')
+		buf = appendEscape(buf, p.Value, EncodeQueryComponent)
+	}
+	return string(buf)
+}
+
+// EncodedLen returns the length of v.Encode(), without building it.
+func (v OrderedValues) EncodedLen() int {
+	n := 0
+	for _, p := range v {
+		n += EscapedLen([]byte(p.Key), EncodeQueryComponent) + 1 + EscapedLen(p.Value, EncodeQueryComponent) + 1
+	}
+	if n > 0 {
+		n-- // no '&' before the first pair
+	}
+	return n
+}
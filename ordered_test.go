@@ -0,0 +1,62 @@
+package bytesurl
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParseQueryOrdered(t *testing.T) {
+	const query = "z=1&a=2;z=3&&b&c=%zz&d=x+y%21"
+	v, err := ParseQueryOrdered([]byte(query))
+	if err == nil {
+		t.Errorf("ParseQueryOrdered(%q) did not report the invalid escape", query)
+	}
+	want := OrderedValues{{"z", []byte("1")}, {"a", []byte("2")}, {"z", []byte("3")}, {"b", []byte("")}, {"d", []byte("x y!")}}
+	if len(v) != len(want) {
+		t.Fatalf("ParseQueryOrdered(%q) = %q, want %q", query, v, want)
+	}
+	for i := range v {
+		if v[i].Key != want[i].Key || bytes.Compare(v[i].Value, want[i].Value) != 0 {
+			t.Errorf("pair %d = %q, want %q", i, v[i], want[i])
+		}
+	}
+	if got := v.Encode(); got != "z=1&a=2&z=3&b=&d=x+y%21" {
+		t.Errorf("Encode() = %q", got)
+	}
+	if got := (&URL{RawQuery: []byte("b=1&a=2")}).QueryOrdered().Encode(); got != "b=1&a=2" {
+		t.Errorf("QueryOrdered().Encode() = %q, want %q", got, "b=1&a=2")
+	}
+}
+
+func TestOrderedValues(t *testing.T) {
+	var v OrderedValues
+	v.Add("sig", []byte("x"))
+	v.Add("b", []byte("1"))
+	v.Add("a", []byte("2"))
+	v.Add("b", []byte("3"))
+	if got := v.Get("b"); string(got) != "1" {
+		t.Errorf("Get(%q) = %q, want %q", "b", got, "1")
+	}
+	if got := v.Values("b"); len(got) != 2 || string(got[1]) != "3" {
+		t.Errorf("Values(%q) = %q", "b", got)
+	}
+	if got := v.Get("missing"); got == nil || len(got) != 0 {
+		t.Errorf("Get(%q) = %q, want empty", "missing", got)
+	}
+
+	v.Set("b", []byte("4 5"))
+	v.Set("c", []byte("&"))
+	if got, want := v.Encode(), "sig=x&b=4+5&a=2&c=%26"; got != want {
+		t.Errorf("Encode() after Set = %q, want %q", got, want)
+	}
+	v.Del("sig")
+	if got, want := v.Encode(), "b=4+5&a=2&c=%26"; got != want {
+		t.Errorf("Encode() after Del = %q, want %q", got, want)
+	}
+	if n := v.EncodedLen(); n != len(v.Encode()) {
+		t.Errorf("EncodedLen() = %d, want %d", n, len(v.Encode()))
+	}
+	if got := OrderedValues(nil).Encode(); got != "" {
+		t.Errorf("nil Encode() = %q", got)
+	}
+}
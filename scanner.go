@@ -0,0 +1,70 @@
+package bytesurl
+
+// A QueryScanner walks the key=value pairs of a raw query in order,
+// splitting them as ParseQuery does, without building Values. The
+// pairs are slices of the query, so scanning does not allocate, and
+// unescaping only allocates for keys and values that hold escapes:
+//
+//	s := NewQueryScanner(u.RawQuery)
+//	for s.Next() {
+//		if string(s.RawKey()) == "id" {
+//			id, err := s.Value()
+//			...
+//		}
+//	}
+//
+// A QueryScanner is a value; copying one saves its position.
+type QueryScanner struct {
+	rest       []byte
+	key, value []byte
+}
+
+// NewQueryScanner returns a QueryScanner over query.
+func NewQueryScanner(query []byte) QueryScanner {
+	return QueryScanner{rest: query}
+}
+
+// ScanQuery returns a QueryScanner over u.RawQuery.
+func (u *URL) ScanQuery() QueryScanner {
+	return NewQueryScanner(u.RawQuery)
+}
+
+// Next advances to the next pair, which then is available through the
+// other methods. It returns false when there are no more pairs.
+func (s *QueryScanner) Next() bool {
+	var ok bool
+	s.key, s.value, s.rest, ok = cutQueryPair(s.rest)
+	return ok
+}
+
+// RawKey returns the key of the current pair, still escaped.
+func (s *QueryScanner) RawKey() []byte { return s.key }
+
+// RawValue returns the value of the current pair, still escaped.
+func (s *QueryScanner) RawValue() []byte { return s.value }
+
+// Key returns the key of the current pair, unescaped as by
+// QueryUnescape. The result aliases the query if the key holds no
+// escapes.
+func (s *QueryScanner) Key() ([]byte, error) {
+	return unescape(s.key, EncodeQueryComponent)
+}
+
+// Value returns the value of the current pair, unescaped as by
+// QueryUnescape. The result aliases the query if the value holds no
+// escapes.
+func (s *QueryScanner) Value() ([]byte, error) {
+	return unescape(s.value, EncodeQueryComponent)
+}
+
+// AppendKey appends the unescaped key of the current pair to dst and
+// returns the extended buffer.
+func (s *QueryScanner) AppendKey(dst []byte) ([]byte, error) {
+	return appendUnescape(dst, s.key, EncodeQueryComponent)
+}
+
+// AppendValue appends the unescaped value of the current pair to dst
+// and returns the extended buffer.
+func (s *QueryScanner) AppendValue(dst []byte) ([]byte, error) {
+	return appendUnescape(dst, s.value, EncodeQueryComponent)
+}
@@ -0,0 +1,116 @@
+package bytesurl
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestQueryScanner(t *testing.T) {
+	const query = "a=1&&b=x+y%21;c&d=%zz&a=2"
+	want := []struct{ rawKey, rawValue, key, value string }{
+		{"a", "1", "a", "1"},
+		{"b", "x+y%21", "b", "x y!"},
+		{"c", "", "c", ""},
+		{"d", "%zz", "d", ""},
+		{"a", "2", "a", "2"},
+	}
+	s := NewQueryScanner([]byte(query))
+	var buf []byte
+	for i, w := range want {
+		if !s.Next() {
+			t.Fatalf("Next() = false at pair %d", i)
+		}
+		if string(s.RawKey()) != w.rawKey || string(s.RawValue()) != w.rawValue {
+			t.Errorf("pair %d: raw %q=%q, want %q=%q", i, s.RawKey(), s.RawValue(), w.rawKey, w.rawValue)
+		}
+		key, err := s.Key()
+		if string(key) != w.key || err != nil {
+			t.Errorf("pair %d: Key() = %q, %v; want %q", i, key, err, w.key)
+		}
+		value, err := s.Value()
+		if w.rawValue == "%zz" {
+			if err == nil {
+				t.Errorf("pair %d: Value() of %q did not fail", i, w.rawValue)
+			}
+			continue
+		}
+		if string(value) != w.value || err != nil {
+			t.Errorf("pair %d: Value() = %q, %v; want %q", i, value, err, w.value)
+		}
+		buf, err = s.AppendValue(buf[:0])
+		if string(buf) != w.value || err != nil {
+			t.Errorf("pair %d: AppendValue() = %q, %v; want %q", i, buf, err, w.value)
+		}
+	}
+	if s.Next() {
+		t.Errorf("Next() = true after the last pair %q", s.RawKey())
+	}
+
+	u, _ := Parse([]byte("http://example.com/?q=go&page=2"))
+	s = u.ScanQuery()
+	s.Next()
+	saved := s
+	s.Next()
+	if saved.Next(); bytes.Compare(saved.RawKey(), s.RawKey()) != 0 {
+		t.Errorf("copied QueryScanner did not keep its position")
+	}
+}
+
+func TestQueryScannerMatchesParseQuery(t *testing.T) {
+	for _, tt := range parseTests {
+		got := make(Values)
+		for s := NewQueryScanner(tt.query); s.Next(); {
+			key, err1 := s.Key()
+			value, err2 := s.Value()
+			if err1 == nil && err2 == nil {
+				got.Add(string(key), value)
+			}
+		}
+		want, _ := ParseQuery(tt.query)
+		if got.Encode() != want.Encode() {
+			t.Errorf("scanning %q = %q, ParseQuery = %q", tt.query, got.Encode(), want.Encode())
+		}
+	}
+}
+
+var scanQuery = []byte("utm_source=newsletter&utm_medium=email&utm_campaign=autumn+sale&ref=home&id=12345&sig=abc%3D%3D")
+
+func TestQueryScannerAllocs(t *testing.T) {
+	buf := make([]byte, 0, 64)
+	allocs := testing.AllocsPerRun(100, func() {
+		for s := NewQueryScanner(scanQuery); s.Next(); {
+			if _, err := s.Key(); err != nil {
+				t.Fatal(err)
+			}
+			var err error
+			if buf, err = s.AppendValue(buf[:0]); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("scanning %q made %v allocations, want 0", scanQuery, allocs)
+	}
+}
+
+func BenchmarkQueryScanner(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(scanQuery)))
+	for i := 0; i < b.N; i++ {
+		for s := NewQueryScanner(scanQuery); s.Next(); {
+			if string(s.RawKey()) == "id" {
+				s.Value()
+				break
+			}
+		}
+	}
+}
+
+func BenchmarkParseQueryGet(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(scanQuery)))
+	for i := 0; i < b.N; i++ {
+		v, _ := ParseQuery(scanQuery)
+		v.Get("id")
+	}
+}
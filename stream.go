@@ -0,0 +1,129 @@
+package bytesurl
+
+import "io"
+
+// streamChunk bounds the memory used by the escaping writer and the
+// unescaping reader, independently of the size of the stream.
+const streamChunk = 4096
+
+// EscapeWriter percent-encodes everything written to it according to
+// an Encoding and writes the result to an underlying io.Writer.
+type EscapeWriter struct {
+	w    io.Writer
+	mode Encoding
+	buf  []byte
+}
+
+// NewEscapeWriter returns an EscapeWriter that writes the escaping of
+// its input to w. Escaping is done byte by byte, so the output equals
+// the escaping of the concatenated input however it is split between
+// writes; no Flush or Close is needed.
+func NewEscapeWriter(w io.Writer, mode Encoding) *EscapeWriter {
+	return &EscapeWriter{w: w, mode: mode}
+}
+
+// Write escapes p and writes the result to the underlying writer.
+// n counts the bytes of p whose escaping has been written.
+func (e *EscapeWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > streamChunk {
+			chunk = chunk[:streamChunk]
+		}
+		e.buf = appendEscape(e.buf[:0], chunk, e.mode)
+		if _, err = e.w.Write(e.buf); err != nil {
+			return n, err
+		}
+		n += len(chunk)
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+// UnescapeReader decodes the percent-encoded content of an underlying
+// io.Reader according to an Encoding.
+type UnescapeReader struct {
+	r    io.Reader
+	mode Encoding
+	buf  []byte // buf[rpos:wpos] is input not decoded yet
+	rpos int
+	wpos int
+	off  int   // stream offset of buf[rpos]
+	err  error // error returned by r
+}
+
+// NewUnescapeReader returns an UnescapeReader that reads from r.
+// Escapes split across reads of r are decoded as a whole. A malformed
+// escape is reported as an EscapeError whose Offset counts from the
+// start of the stream, once the bytes before it have been read.
+func NewUnescapeReader(r io.Reader, mode Encoding) *UnescapeReader {
+	return &UnescapeReader{r: r, mode: mode}
+}
+
+// Read reads up to len(p) unescaped bytes into p.
+func (u *UnescapeReader) Read(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for {
+		if n, err = u.decode(p); n > 0 || err != nil {
+			return n, err
+		}
+		if u.err != nil {
+			return 0, u.err
+		}
+		u.fill()
+	}
+}
+
+// decode decodes buffered input into p. It stops before an escape
+// that is not complete yet, and before a malformed one, which it
+// reports once nothing has been decoded.
+func (u *UnescapeReader) decode(p []byte) (n int, err error) {
+	for u.rpos < u.wpos && n < len(p) {
+		in := u.buf[u.rpos:u.wpos]
+		c, size := in[0], 1
+		switch c {
+		case '%':
+			malformed := true
+			if len(in) >= 3 {
+				_, _, eerr := countEscapes(in[:3], u.mode)
+				malformed = eerr != nil
+			} else if u.err == nil {
+				// Wait for the rest of the escape.
+				return n, nil
+			}
+			if malformed {
+				if n > 0 {
+					return n, nil
+				}
+				if len(in) > 3 {
+					in = in[:3]
+				}
+				return 0, EscapeError{string(in), u.off}
+			}
+			c, size = unhex(in[1])<<4|unhex(in[2]), 3
+		case '+':
+			if u.mode == EncodeQueryComponent {
+				c = ' '
+			}
+		}
+		p[n] = c
+		n++
+		u.rpos += size
+		u.off += size
+	}
+	return n, nil
+}
+
+// fill reads more input after the bytes not decoded yet.
+func (u *UnescapeReader) fill() {
+	if u.buf == nil {
+		u.buf = make([]byte, streamChunk)
+	}
+	u.wpos = copy(u.buf, u.buf[u.rpos:u.wpos])
+	u.rpos = 0
+	var m int
+	m, u.err = u.r.Read(u.buf[u.wpos:])
+	u.wpos += m
+}
@@ -0,0 +1,91 @@
+package bytesurl
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestEscapeWriter(t *testing.T) {
+	for _, tt := range escapeTests {
+		var buf bytes.Buffer
+		w := NewEscapeWriter(&buf, EncodeQueryComponent)
+		for i := range tt.in {
+			if n, err := w.Write(tt.in[i : i+1]); n != 1 || err != nil {
+				t.Fatalf("Write = %d, %v; want 1, nil", n, err)
+			}
+		}
+		if bytes.Compare(buf.Bytes(), tt.out) != 0 {
+			t.Errorf("EscapeWriter(%q) wrote %q, want %q", tt.in, buf.Bytes(), tt.out)
+		}
+	}
+
+	in := bytes.Repeat([]byte("a/b c?"), 3*streamChunk)
+	var buf bytes.Buffer
+	n, err := NewEscapeWriter(&buf, EncodePathSegment).Write(in)
+	if n != len(in) || err != nil {
+		t.Fatalf("Write = %d, %v; want %d, nil", n, err, len(in))
+	}
+	if want := PathSegmentEscape(in); bytes.Compare(buf.Bytes(), want) != 0 {
+		t.Errorf("EscapeWriter wrote %d bytes, want %d", buf.Len(), len(want))
+	}
+}
+
+type failWriter struct{}
+
+func (failWriter) Write(p []byte) (int, error) { return 0, io.ErrShortWrite }
+
+func TestEscapeWriterError(t *testing.T) {
+	n, err := NewEscapeWriter(failWriter{}, EncodePath).Write([]byte("a b"))
+	if n != 0 || err != io.ErrShortWrite {
+		t.Errorf("Write = %d, %v; want 0, %v", n, err, io.ErrShortWrite)
+	}
+}
+
+func TestUnescapeReader(t *testing.T) {
+	for _, tt := range unescapeTests {
+		for _, r := range []io.Reader{
+			bytes.NewReader(tt.in),
+			iotest.OneByteReader(bytes.NewReader(tt.in)),
+			iotest.DataErrReader(iotest.HalfReader(bytes.NewReader(tt.in))),
+		} {
+			got, err := ioutil.ReadAll(NewUnescapeReader(r, EncodeQueryComponent))
+			if err != tt.err {
+				t.Errorf("UnescapeReader(%q) error = %v, want %v", tt.in, err, tt.err)
+				continue
+			}
+			if err == nil && bytes.Compare(got, tt.out) != 0 {
+				t.Errorf("UnescapeReader(%q) = %q, want %q", tt.in, got, tt.out)
+			}
+		}
+	}
+
+	in := strings.Repeat("a%2Fb+c%41", streamChunk)
+	got, err := ioutil.ReadAll(NewUnescapeReader(strings.NewReader(in), EncodePathSegment))
+	if err != nil {
+		t.Fatalf("ReadAll returned error %v", err)
+	}
+	if want, _ := PathUnescape([]byte(in)); bytes.Compare(got, want) != 0 {
+		t.Errorf("UnescapeReader read %d bytes, want %d", len(got), len(want))
+	}
+}
+
+func TestUnescapeReaderError(t *testing.T) {
+	r := NewUnescapeReader(iotest.OneByteReader(strings.NewReader("abc%4x")), EncodePath)
+	p := make([]byte, 16)
+	n, err := io.ReadAtLeast(r, p, 3)
+	if n != 3 || string(p[:n]) != "abc" {
+		t.Errorf("Read = %q, %v; want %q", p[:n], err, "abc")
+	}
+	var eerr EscapeError
+	if _, err = r.Read(p); !errors.As(err, &eerr) || eerr != (EscapeError{"%4x", 3}) {
+		t.Errorf("Read error = %#v; want %#v", err, EscapeError{"%4x", 3})
+	}
+	if _, err = r.Read(p); err != eerr {
+		t.Errorf("Read error is not sticky: %v", err)
+	}
+}
@@ -0,0 +1,222 @@
+package bytesurl
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Errors returned in strict mode. ErrColonInFirstSegment is returned
+// for a relative reference whose first path segment contains a colon,
+// which would make it indistinguishable from a scheme.
+// ErrInvalidCharacter is wrapped by the errors describing a byte the
+// grammar does not allow.
+var (
+	ErrColonInFirstSegment = errors.New("first path segment in URL cannot contain colon")
+	ErrInvalidCharacter    = errors.New("invalid character")
+)
+
+// isUnreserved reports whether c is an RFC 3986 §2.3 unreserved character.
+func isUnreserved(c byte) bool {
+	return 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+// isSubDelim reports whether c is an RFC 3986 §2.2 sub-delims character.
+func isSubDelim(c byte) bool {
+	switch c {
+	case '!', '$', '&', '\'', '(', ')', '*', '+', ',', ';', '=':
+		return true
+	}
+	return false
+}
+
+// Extra characters each component allows on top of unreserved,
+// pct-encoded and sub-delims (RFC 3986 Appendix A).
+const (
+	strictUserinfo = ":"
+	strictRegName  = ""
+	strictPath     = ":@/"
+	strictQuery    = ":@/?"
+	strictFragment = ":@/?"
+)
+
+// validateStrict checks rawurl against the URI-reference rule of
+// RFC 3986 Appendix A, component by component from left to right,
+// and describes the first violation found. Errors are located with
+// errorAt.
+func validateStrict(rawurl []byte) error {
+	end := len(rawurl)
+	fragment := bytes.IndexByte(rawurl, '#')
+	if fragment >= 0 {
+		end = fragment
+	}
+	query := bytes.IndexByte(rawurl[:end], '?')
+	if query >= 0 {
+		end = query
+	}
+
+	// scheme ":" hier-part, or relative-part.
+	hier, off := rawurl[:end], 0
+	for i, c := range hier {
+		if c == ':' {
+			if i == 0 {
+				return errorAt(ComponentScheme, 0, ErrProtocolScheme)
+			}
+			hier, off = hier[i+1:], i+1
+			break
+		}
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' ||
+			i > 0 && ('0' <= c && c <= '9' || c == '+' || c == '-' || c == '.')) {
+			// Not a scheme, so this is a relative reference whose
+			// first segment (path-noscheme) must not contain a colon.
+			seg := hier
+			if j := bytes.IndexByte(seg, '/'); j >= 0 {
+				seg = seg[:j]
+			}
+			if j := bytes.IndexByte(seg, ':'); j >= 0 {
+				return errorAt(ComponentPath, j, ErrColonInFirstSegment)
+			}
+			break
+		}
+	}
+
+	if bytes.HasPrefix(hier, DoubleSlash) {
+		authority := hier[2:]
+		if i := bytes.IndexByte(authority, '/'); i >= 0 {
+			authority, hier = authority[:i], authority[i:]
+		} else {
+			hier = EmptyByte
+		}
+		if err := validateStrictAuthority(authority); err != nil {
+			return errorAt(ComponentHost, off+2, err)
+		}
+		off += 2 + len(authority)
+	}
+	if err := validateStrictChars(hier, strictPath, ComponentPath); err != nil {
+		return errorAt(ComponentPath, off, err)
+	}
+	if query >= 0 {
+		q := rawurl[query+1:]
+		if fragment >= 0 {
+			q = rawurl[query+1 : fragment]
+		}
+		if err := validateStrictChars(q, strictQuery, ComponentQuery); err != nil {
+			return errorAt(ComponentQuery, query+1, err)
+		}
+	}
+	if fragment >= 0 {
+		if err := validateStrictChars(rawurl[fragment+1:], strictFragment, ComponentFragment); err != nil {
+			return errorAt(ComponentFragment, fragment+1, err)
+		}
+	}
+	return nil
+}
+
+// validateStrictAuthority checks [ userinfo "@" ] host [ ":" port ].
+func validateStrictAuthority(authority []byte) error {
+	off := 0
+	if i := bytes.LastIndexByte(authority, '@'); i >= 0 {
+		if err := validateStrictChars(authority[:i], strictUserinfo, ComponentUserinfo); err != nil {
+			return err
+		}
+		authority, off = authority[i+1:], i+1
+	}
+	host, port := authority, EmptyByte
+	if len(host) > 0 && host[0] == '[' {
+		i := bytes.IndexByte(host, ']')
+		if i < 0 {
+			return errorAt(ComponentHost, off, ErrMissingBracket)
+		}
+		host, port = host[:i+1], host[i+1:]
+		if err := validateStrictIPLiteral(host[1:i]); err != nil {
+			return errorAt(ComponentHost, off+1, err)
+		}
+	} else {
+		if i := bytes.IndexByte(host, ':'); i >= 0 {
+			host, port = host[:i], host[i:]
+		}
+		if err := validateStrictChars(host, strictRegName, ComponentHost); err != nil {
+			return errorAt(ComponentHost, off, err)
+		}
+	}
+	if len(port) == 0 {
+		return nil
+	}
+	off += len(host)
+	if port[0] != ':' {
+		return invalidCharacterError(port[0], ComponentHost, off)
+	}
+	for i, c := range port[1:] {
+		if c < '0' || c > '9' {
+			return invalidCharacterError(c, ComponentPort, off+1+i)
+		}
+	}
+	return nil
+}
+
+// validateStrictIPLiteral checks the content of an IP-literal,
+// including an RFC 6874 zone identifier.
+func validateStrictIPLiteral(literal []byte) error {
+	zone := bytes.Index(literal, ZoneByte)
+	if zone < 0 {
+		if !validIPLiteral(literal, false) {
+			return errorAt(ComponentHost, 0, ErrInvalidIPLiteral)
+		}
+		return nil
+	}
+	if !validIPLiteral(literal[:zone], true) || len(literal) == zone+len(ZoneByte) {
+		return errorAt(ComponentHost, 0, ErrInvalidIPLiteral)
+	}
+	// ZoneID = 1*( unreserved / pct-encoded )
+	for i := zone + len(ZoneByte); i < len(literal); i++ {
+		if literal[i] == '%' {
+			if err := validateStrictEscape(literal[i:]); err != nil {
+				return errorAt(ComponentHost, i, err)
+			}
+			i += 2
+		} else if !isUnreserved(literal[i]) {
+			return invalidCharacterError(literal[i], ComponentHost, i)
+		}
+	}
+	return nil
+}
+
+// validateStrictChars checks that s consists only of unreserved
+// characters, well-formed percent-encodings, sub-delims and the
+// component specific bytes in extra.
+func validateStrictChars(s []byte, extra string, component Component) error {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '%':
+			if err := validateStrictEscape(s[i:]); err != nil {
+				return errorAt(component, i, err)
+			}
+			i += 2
+		case isUnreserved(c), isSubDelim(c):
+		case c < 0x80 && strings.IndexByte(extra, c) >= 0:
+		default:
+			return invalidCharacterError(c, component, i)
+		}
+	}
+	return nil
+}
+
+// validateStrictEscape checks that s starts with pct-encoded.
+func validateStrictEscape(s []byte) error {
+	if len(s) < 3 || !ishex(s[1]) || !ishex(s[2]) {
+		if len(s) > 3 {
+			s = s[:3]
+		}
+		return EscapeError{string(s), 0}
+	}
+	return nil
+}
+
+func invalidCharacterError(c byte, component Component, offset int) error {
+	err := fmt.Errorf("%w %s in %s", ErrInvalidCharacter, strconv.Quote(string([]byte{c})), component)
+	return errorAt(component, offset, err)
+}
@@ -0,0 +1,77 @@
+package bytesurl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/bits"
+)
+
+// Escaping and unescaping mostly copy long runs of bytes that need no
+// work. The helpers below find the end of such a run a word, eight
+// bytes, at a time (SWAR: SIMD within a register).
+
+const (
+	lsb = 0x0101010101010101 // the low bit of each byte
+	msb = 0x8080808080808080 // the high bit of each byte
+)
+
+// load returns the first eight bytes of s as a word.
+func load(s []byte) uint64 {
+	return binary.LittleEndian.Uint64(s)
+}
+
+// zeroBytes returns a word with the high bit set in at least the zero
+// bytes of x; a byte above a zero byte may be flagged too, so only the
+// lowest flag is exact.
+func zeroBytes(x uint64) uint64 {
+	return (x - lsb) &^ x & msb
+}
+
+// inRange returns x, a word of ASCII bytes, with the high bit of each
+// byte set if the byte is in [lo, hi] and every other bit cleared. The
+// sums cannot carry from one byte into the next as no byte exceeds 0x7f.
+func inRange(x uint64, lo, hi byte) uint64 {
+	return (x + lsb*uint64(0x80-lo)) &^ (x + lsb*uint64(0x7f-hi)) & msb
+}
+
+// isUnreservedWord reports whether the eight bytes of x are all
+// unreserved characters: ASCII letters, digits and "-._~".
+func isUnreservedWord(x uint64) bool {
+	if x&msb != 0 {
+		return false
+	}
+	m := inRange(x|lsb*0x20, 'a', 'z') | inRange(x, '0', '9') |
+		inRange(x, '-', '.') | inRange(x, '_', '_') | inRange(x, '~', '~')
+	return m == msb
+}
+
+// unreserved is the set of the RFC 3986 §2.3 unreserved characters.
+var unreserved = EncodeSet{}.AddRange('A', 'Z').AddRange('a', 'z').AddRange('0', '9').Add("-._~")
+
+// keepsUnreserved reports whether s escapes none of the unreserved
+// characters, so that words of them can be skipped with isUnreservedWord.
+// It holds for every predefined set.
+func (s *EncodeSet) keepsUnreserved() bool {
+	return s[0]&unreserved[0] == 0 && s[1]&unreserved[1] == 0
+}
+
+// indexEscape returns the index of the first '%' in s, or of the first
+// '%' or '+' if plus is set, or -1 if there is none.
+func indexEscape(s []byte, plus bool) int {
+	if !plus {
+		return bytes.IndexByte(s, '%')
+	}
+	i := 0
+	for ; i+8 <= len(s); i += 8 {
+		x := load(s[i:])
+		if m := zeroBytes(x^lsb*'%') | zeroBytes(x^lsb*'+'); m != 0 {
+			return i + bits.TrailingZeros64(m)/8
+		}
+	}
+	for ; i < len(s); i++ {
+		if s[i] == '%' || s[i] == '+' {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,265 @@
+package bytesurl
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestIsUnreservedWord(t *testing.T) {
+	word := []byte("aZ09-._~")
+	if !isUnreservedWord(load(word)) {
+		t.Fatalf("isUnreservedWord(%q) = false", word)
+	}
+	for i := 0; i < 256; i++ {
+		c := byte(i)
+		for pos := 0; pos < 8; pos++ {
+			w := append([]byte{}, word...)
+			w[pos] = c
+			if got, want := isUnreservedWord(load(w)), unreserved.Contains(c); got != want {
+				t.Errorf("isUnreservedWord(%q) = %v, want %v", w, got, want)
+			}
+		}
+	}
+}
+
+func TestIndexEscape(t *testing.T) {
+	for _, s := range []string{"", "abc", "%", "abcdefgh%", "abcdefghijklmnop+q%", "a+b", "abcdefghijklmnopqrstuvwxyz"} {
+		if got, want := indexEscape([]byte(s), true), bytes.IndexAny([]byte(s), "%+"); got != want {
+			t.Errorf("indexEscape(%q, true) = %d, want %d", s, got, want)
+		}
+		if got, want := indexEscape([]byte(s), false), bytes.IndexByte([]byte(s), '%'); got != want {
+			t.Errorf("indexEscape(%q, false) = %d, want %d", s, got, want)
+		}
+	}
+}
+
+// refEscape and refUnescape are copies of the byte-at-a-time escape and
+// unescape the package had before escaping was table-driven and
+// scanned a word at a time, with their nested-switch refShouldEscape,
+// refIshex and refUnhex. The current versions are checked and measured
+// against them, so they must not be changed to share code with the
+// package.
+func refEscape(s []byte, mode Encoding) []byte {
+	spaceCount, hexCount := 0, 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if refShouldEscape(c, mode) {
+			if c == ' ' && mode == EncodeQueryComponent {
+				spaceCount++
+			} else {
+				hexCount++
+			}
+		}
+	}
+	if spaceCount == 0 && hexCount == 0 {
+		return s
+	}
+	t := make([]byte, 0, len(s)+2*hexCount)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == ' ' && mode == EncodeQueryComponent:
+			t = append(t, '+')
+		case refShouldEscape(c, mode):
+			t = append(t, '%', "0123456789ABCDEF"[c>>4], "0123456789ABCDEF"[c&15])
+		default:
+			t = append(t, c)
+		}
+	}
+	return t
+}
+
+func refUnescape(s []byte, mode Encoding) ([]byte, error) {
+	n, hasPlus := 0, false
+	for i := 0; i < len(s); {
+		switch s[i] {
+		case '%':
+			n++
+			if i+2 >= len(s) || !refIshex(s[i+1]) || !refIshex(s[i+2]) {
+				return EmptyByte, EscapeError{}
+			}
+			i += 3
+		case '+':
+			hasPlus = mode == EncodeQueryComponent
+			i++
+		default:
+			i++
+		}
+	}
+	if n == 0 && !hasPlus {
+		return s, nil
+	}
+	t := make([]byte, 0, len(s)-2*n)
+	for i := 0; i < len(s); {
+		switch s[i] {
+		case '%':
+			t = append(t, refUnhex(s[i+1])<<4|refUnhex(s[i+2]))
+			i += 3
+		case '+':
+			if mode == EncodeQueryComponent {
+				t = append(t, ' ')
+			} else {
+				t = append(t, '+')
+			}
+			i++
+		default:
+			t = append(t, s[i])
+			i++
+		}
+	}
+	return t, nil
+}
+
+func refShouldEscape(c byte, mode Encoding) bool {
+	// §2.3 Unreserved characters (alphanum)
+	if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' {
+		return false
+	}
+
+	if mode == EncodeHost || mode == EncodeZone {
+		// §3.2.2 Host allows
+		//	sub-delims = "!" / "$" / "&" / "'" / "(" / ")" / "*" / "+" / "," / ";" / "="
+		// as part of reg-name.
+		// We add : because we include :port as part of host.
+		// We add [ ] because we include [ipv6]:port as part of host.
+		switch c {
+		case '!', '$', '&', '\'', '(', ')', '*', '+', ',', ';', '=', ':', '[', ']':
+			return false
+		}
+		if c >= 0x80 {
+			return false
+		}
+	}
+
+	switch c {
+	case '-', '_', '.', '~': // §2.3 Unreserved characters (mark)
+		return false
+
+	case '$', '&', '+', ',', '/', ':', ';', '=', '?', '@': // §2.2 Reserved characters (reserved)
+		// Different sections of the URL allow a few of
+		// the reserved characters to appear unescaped.
+		switch mode {
+		case EncodePath: // §3.3
+			return c == '?'
+
+		case EncodePathSegment: // §3.3
+			return c == '/' || c == ';' || c == ',' || c == '?'
+
+		case EncodeUserPassword: // §3.2.1
+			return c == '@' || c == '/' || c == '?' || c == ':'
+
+		case EncodeQueryComponent: // §3.4
+			return true
+
+		case EncodeFragment: // §4.1
+			return false
+		}
+	}
+
+	// Everything else must be escaped.
+	return true
+}
+
+func refIshex(c byte) bool {
+	switch {
+	case '0' <= c && c <= '9':
+		return true
+	case 'a' <= c && c <= 'f':
+		return true
+	case 'A' <= c && c <= 'F':
+		return true
+	}
+	return false
+}
+
+func refUnhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10
+	}
+	return 0
+}
+
+// urlCorpus holds realistic decoded URL components.
+var urlCorpus = [][]byte{
+	[]byte("/api/v2/repositories/ernestas-poskus/bytesurl/commits"),
+	[]byte("/static/js/vendor.3f9a8c1e.min.js"),
+	[]byte("/wiki/Uniform_Resource_Locator"),
+	[]byte("utm_source=newsletter&utm_medium=email&utm_campaign=autumn-sale"),
+	[]byte("how to percent encode a url in go"),
+	[]byte("/search/results page 2/übersicht"),
+	[]byte("redirect_uri=https://example.com/oauth/callback?state=abc123"),
+	[]byte("0f8fad5b-d9cb-469f-a165-70867728950e"),
+}
+
+var testModes = []Encoding{EncodePath, EncodePathSegment, EncodeQueryComponent, EncodeFragment, EncodeUserPassword, EncodeHost}
+
+func TestEscapeMatchesReference(t *testing.T) {
+	inputs := append([][]byte{}, urlCorpus...)
+	r := rand.New(rand.NewSource(1))
+	const alphabet = "abcXYZ019-._~ %+/?#&=:@\x00\x7f\x80\xff"
+	for i := 0; i < 500; i++ {
+		b := make([]byte, r.Intn(40))
+		for j := range b {
+			b[j] = alphabet[r.Intn(len(alphabet))]
+		}
+		inputs = append(inputs, b)
+	}
+	for _, in := range inputs {
+		for _, mode := range testModes {
+			if got, want := escape(in, mode), refEscape(in, mode); bytes.Compare(got, want) != 0 {
+				t.Errorf("escape(%q, %d) = %q, want %q", in, mode, got, want)
+			}
+			got, err := unescape(in, mode)
+			want, refErr := refUnescape(in, mode)
+			if (err != nil) != (refErr != nil) || bytes.Compare(got, want) != 0 {
+				t.Errorf("unescape(%q, %d) = %q, %v; want %q, %v", in, mode, got, err, want, refErr)
+			}
+		}
+	}
+}
+
+func benchmarkCorpus(b *testing.B, f func([]byte, Encoding), corpus [][]byte) {
+	n := 0
+	for _, s := range corpus {
+		n += len(s)
+	}
+	b.SetBytes(int64(n))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, s := range corpus {
+			f(s, EncodeQueryComponent)
+		}
+	}
+}
+
+func BenchmarkQueryEscape(b *testing.B) {
+	b.Run("ref", func(b *testing.B) {
+		benchmarkCorpus(b, func(s []byte, mode Encoding) { refEscape(s, mode) }, urlCorpus)
+	})
+	b.Run("swar", func(b *testing.B) {
+		benchmarkCorpus(b, func(s []byte, mode Encoding) { escape(s, mode) }, urlCorpus)
+	})
+}
+
+func BenchmarkQueryUnescape(b *testing.B) {
+	escaped := make([][]byte, len(urlCorpus))
+	for i, s := range urlCorpus {
+		escaped[i] = QueryEscape(s)
+	}
+	for _, bb := range []struct {
+		name   string
+		corpus [][]byte
+	}{{"plain", urlCorpus}, {"escaped", escaped}} {
+		b.Run(bb.name+"/ref", func(b *testing.B) {
+			benchmarkCorpus(b, func(s []byte, mode Encoding) { refUnescape(s, mode) }, bb.corpus)
+		})
+		b.Run(bb.name+"/swar", func(b *testing.B) {
+			benchmarkCorpus(b, func(s []byte, mode Encoding) { unescape(s, mode) }, bb.corpus)
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package bytesurl
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrMissingKey is returned by the typed getters of Values for a key
+// that has no value.
+var ErrMissingKey = errors.New("missing value")
+
+// A KeyError records the query key whose value failed to convert.
+type KeyError struct {
+	Key string
+	Err error
+}
+
+func (e *KeyError) Error() string { return "key " + strconv.Quote(e.Key) + ": " + e.Err.Error() }
+
+// Unwrap returns the underlying error.
+func (e *KeyError) Unwrap() error { return e.Err }
+
+// Has reports whether key is set, even to an empty value.
+func (v Values) Has(key string) bool {
+	_, ok := v[key]
+	return ok
+}
+
+// Lookup returns the first value associated with the given key and
+// whether there is one, which tells a missing key from an empty value.
+func (v Values) Lookup(key string) ([]byte, bool) {
+	vs := v[key]
+	if len(vs) == 0 {
+		return EmptyByte, false
+	}
+	return vs[0], true
+}
+
+// convert calls parse with the first value of key. Errors, including
+// ErrMissingKey if there is no value, are returned as a *KeyError.
+func (v Values) convert(key string, parse func(s string) error) error {
+	b, ok := v.Lookup(key)
+	if !ok {
+		return &KeyError{key, ErrMissingKey}
+	}
+	if err := parse(string(b)); err != nil {
+		return &KeyError{key, err}
+	}
+	return nil
+}
+
+// GetInt returns the first value of key as a decimal int.
+func (v Values) GetInt(key string) (x int, err error) {
+	err = v.convert(key, func(s string) (err error) {
+		x, err = strconv.Atoi(s)
+		return
+	})
+	return
+}
+
+// GetUint returns the first value of key as a decimal uint.
+func (v Values) GetUint(key string) (x uint, err error) {
+	err = v.convert(key, func(s string) error {
+		u, err := strconv.ParseUint(s, 10, 0)
+		x = uint(u)
+		return err
+	})
+	return
+}
+
+// GetFloat returns the first value of key as a float64.
+func (v Values) GetFloat(key string) (x float64, err error) {
+	err = v.convert(key, func(s string) (err error) {
+		x, err = strconv.ParseFloat(s, 64)
+		return
+	})
+	return
+}
+
+// GetBool returns the first value of key as a bool, as accepted by
+// strconv.ParseBool.
+func (v Values) GetBool(key string) (x bool, err error) {
+	err = v.convert(key, func(s string) (err error) {
+		x, err = strconv.ParseBool(s)
+		return
+	})
+	return
+}
+
+// GetDuration returns the first value of key as a duration, such as
+// "1m30s", as accepted by time.ParseDuration.
+func (v Values) GetDuration(key string) (x time.Duration, err error) {
+	err = v.convert(key, func(s string) (err error) {
+		x, err = time.ParseDuration(s)
+		return
+	})
+	return
+}
+
+// GetTime returns the first value of key as a time in layout, as
+// accepted by time.Parse.
+func (v Values) GetTime(key, layout string) (x time.Time, err error) {
+	err = v.convert(key, func(s string) (err error) {
+		x, err = time.Parse(layout, s)
+		return
+	})
+	return
+}
+
+// ValidationErrors lists the errors a Validator collected, in the order
+// the keys were checked.
+type ValidationErrors []*KeyError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the errors, so errors.Is and errors.As look at each.
+func (e ValidationErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// A Validator reads typed values from Values and, instead of stopping
+// at the first value that fails to convert, collects every error for
+// Err to report:
+//
+//	c := NewValidator(values)
+//	limit := c.Int("limit", 20)
+//	since := c.Time("since", time.RFC3339, time.Time{})
+//	c.Required("q")
+//	if err := c.Err(); err != nil {
+//		// err lists all the bad keys
+//	}
+type Validator struct {
+	values Values
+	errs   ValidationErrors
+}
+
+// NewValidator returns a Validator reading from values.
+func NewValidator(values Values) *Validator {
+	return &Validator{values: values}
+}
+
+// Err returns the collected errors as ValidationErrors, or nil if
+// there are none.
+func (c *Validator) Err() error {
+	if len(c.errs) == 0 {
+		return nil
+	}
+	return c.errs
+}
+
+// Required records ErrMissingKey if key has no value.
+func (c *Validator) Required(key string) {
+	if _, ok := c.values.Lookup(key); !ok {
+		c.errs = append(c.errs, &KeyError{key, ErrMissingKey})
+	}
+}
+
+// ok reports whether err, from a typed getter, is nil. Other errors
+// than a missing key are recorded.
+func (c *Validator) ok(err error) bool {
+	if err == nil {
+		return true
+	}
+	if kerr := err.(*KeyError); kerr.Err != ErrMissingKey {
+		c.errs = append(c.errs, kerr)
+	}
+	return false
+}
+
+// Int returns the value of key as by GetInt, or def if it is missing
+// or invalid.
+func (c *Validator) Int(key string, def int) int {
+	if x, err := c.values.GetInt(key); c.ok(err) {
+		return x
+	}
+	return def
+}
+
+// Uint returns the value of key as by GetUint, or def if it is missing
+// or invalid.
+func (c *Validator) Uint(key string, def uint) uint {
+	if x, err := c.values.GetUint(key); c.ok(err) {
+		return x
+	}
+	return def
+}
+
+// Float returns the value of key as by GetFloat, or def if it is
+// missing or invalid.
+func (c *Validator) Float(key string, def float64) float64 {
+	if x, err := c.values.GetFloat(key); c.ok(err) {
+		return x
+	}
+	return def
+}
+
+// Bool returns the value of key as by GetBool, or def if it is missing
+// or invalid.
+func (c *Validator) Bool(key string, def bool) bool {
+	if x, err := c.values.GetBool(key); c.ok(err) {
+		return x
+	}
+	return def
+}
+
+// Duration returns the value of key as by GetDuration, or def if it is
+// missing or invalid.
+func (c *Validator) Duration(key string, def time.Duration) time.Duration {
+	if x, err := c.values.GetDuration(key); c.ok(err) {
+		return x
+	}
+	return def
+}
+
+// Time returns the value of key as by GetTime, or def if it is missing
+// or invalid.
+func (c *Validator) Time(key, layout string, def time.Time) time.Time {
+	if x, err := c.values.GetTime(key, layout); c.ok(err) {
+		return x
+	}
+	return def
+}
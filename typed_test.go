@@ -0,0 +1,89 @@
+package bytesurl
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestValuesTypedGetters(t *testing.T) {
+	v, _ := ParseQuery([]byte("n=-42&u=7&f=2.5&b=true&d=1m30s&t=2024-02-29&empty=&bad=x"))
+
+	if x, err := v.GetInt("n"); x != -42 || err != nil {
+		t.Errorf("GetInt = %d, %v", x, err)
+	}
+	if x, err := v.GetUint("u"); x != 7 || err != nil {
+		t.Errorf("GetUint = %d, %v", x, err)
+	}
+	if x, err := v.GetFloat("f"); x != 2.5 || err != nil {
+		t.Errorf("GetFloat = %v, %v", x, err)
+	}
+	if x, err := v.GetBool("b"); !x || err != nil {
+		t.Errorf("GetBool = %v, %v", x, err)
+	}
+	if x, err := v.GetDuration("d"); x != 90*time.Second || err != nil {
+		t.Errorf("GetDuration = %v, %v", x, err)
+	}
+	if x, err := v.GetTime("t", "2006-01-02"); !x.Equal(time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)) || err != nil {
+		t.Errorf("GetTime = %v, %v", x, err)
+	}
+
+	if _, err := v.GetUint("n"); !errors.Is(err, strconv.ErrSyntax) {
+		t.Errorf("GetUint of a negative number returned %v", err)
+	}
+	_, err := v.GetInt("missing")
+	var kerr *KeyError
+	if !errors.As(err, &kerr) || kerr.Key != "missing" || kerr.Err != ErrMissingKey {
+		t.Errorf("GetInt of a missing key returned %v", err)
+	}
+
+	if !v.Has("empty") || v.Has("missing") {
+		t.Errorf("Has does not tell set keys from missing ones")
+	}
+	if b, ok := v.Lookup("empty"); !ok || len(b) != 0 {
+		t.Errorf("Lookup(%q) = %q, %v; want empty, true", "empty", b, ok)
+	}
+	if b, ok := v.Lookup("missing"); ok || len(b) != 0 {
+		t.Errorf("Lookup(%q) = %q, %v; want empty, false", "missing", b, ok)
+	}
+}
+
+func TestValidator(t *testing.T) {
+	v, _ := ParseQuery([]byte("limit=ten&offset=5&ratio=0.5&debug=yes&timeout=soon&since=2024-02-29T12:00:00Z"))
+	c := NewValidator(v)
+	limit := c.Int("limit", 20)
+	offset := c.Uint("offset", 0)
+	ratio := c.Float("ratio", 1)
+	debug := c.Bool("debug", false)
+	timeout := c.Duration("timeout", time.Second)
+	since := c.Time("since", time.RFC3339, time.Time{})
+	page := c.Int("page", 1)
+	c.Required("q")
+	c.Required("offset")
+
+	if limit != 20 || offset != 5 || ratio != 0.5 || debug || timeout != time.Second || since.IsZero() || page != 1 {
+		t.Errorf("Validator returned %v %v %v %v %v %v %v", limit, offset, ratio, debug, timeout, since, page)
+	}
+	err := c.Err()
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Err() = %v; want ValidationErrors", err)
+	}
+	keys := []string{"limit", "debug", "timeout", "q"}
+	if len(errs) != len(keys) {
+		t.Fatalf("Err() = %v; want errors for %q", err, keys)
+	}
+	for i, key := range keys {
+		if errs[i].Key != key {
+			t.Errorf("error %d is for %q, want %q", i, errs[i].Key, key)
+		}
+	}
+	if !errors.Is(err, ErrMissingKey) || !errors.Is(err, strconv.ErrSyntax) {
+		t.Errorf("Err() does not unwrap to its errors: %v", err)
+	}
+
+	if err := NewValidator(v).Err(); err != nil {
+		t.Errorf("Err() of an unused Validator = %v", err)
+	}
+}
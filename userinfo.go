@@ -1,7 +1,5 @@
 package bytesurl
 
-import "bytes"
-
 // User returns a Userinfo containing the provided username
 // and no password set.
 func User(username []byte) *Userinfo {
@@ -45,13 +43,26 @@ func (u *Userinfo) Password() ([]byte, bool) {
 // Bytes returns the encoded userinfo information in the standard form
 // of "username[:password]".
 func (u *Userinfo) Bytes() []byte {
-	var buffer bytes.Buffer
-	buffer.Write(escape(u.username, encodeUserPassword))
+	return u.appendBytes(make([]byte, 0, u.EncodedLen()))
+}
+
+// EncodedLen returns the length of u.Bytes(), without building it.
+func (u *Userinfo) EncodedLen() int {
+	n := EscapedLen(u.username, EncodeUserPassword)
+	if u.passwordSet {
+		n += 1 + EscapedLen(u.password, EncodeUserPassword)
+	}
+	return n
+}
+
+// appendBytes appends u.Bytes() to dst.
+func (u *Userinfo) appendBytes(dst []byte) []byte {
+	dst = appendEscape(dst, u.username, EncodeUserPassword)
 	if u.passwordSet {
-		buffer.Write(ColonByte)
-		buffer.Write(escape(u.password, encodeUserPassword))
+		dst = append(dst, ':')
+		dst = appendEscape(dst, u.password, EncodeUserPassword)
 	}
-	return buffer.Bytes()
+	return dst
 }
 
 // String returns the encoded userinfo information in the standard form
@@ -50,25 +50,39 @@ func (v Values) Del(key string) {
 // encountered, if any.
 func ParseQuery(query []byte) (m Values, err error) {
 	m = make(Values)
-	err = parseQuery(m, query)
+	err = parseQuery(query, m.Add)
 	return
 }
 
-func parseQuery(m Values, query []byte) (err error) {
-	for bytes.Compare(query, EmptyByte) != 0 {
-		key := query
-		if i := bytes.IndexAny(key, "&;"); i >= 0 {
-			key, query = key[:i], key[i+1:]
-		} else {
-			query = EmptyByte
-		}
-		if bytes.Equal(key, EmptyByte) {
-			continue
+// ParseQueryLenient is like ParseQuery, but decodes keys and values
+// with QueryUnescapeLenient, so no pair is dropped. It returns the
+// number of invalid escapes that were kept literally.
+func ParseQueryLenient(query []byte) (m Values, invalid int) {
+	m = make(Values)
+	for {
+		key, value, rest, ok := cutQueryPair(query)
+		if !ok {
+			return m, invalid
 		}
-		value := EmptyByte
-		if i := bytes.Index(key, EqualByte); i >= 0 {
-			key, value = key[:i], key[i+1:]
+		query = rest
+		key, n := QueryUnescapeLenient(key)
+		value, n1 := QueryUnescapeLenient(value)
+		invalid += n + n1
+		indexKey := string(key)
+		m[indexKey] = append(m[indexKey], value)
+	}
+}
+
+// parseQuery calls add with the unescaped key and value of each pair
+// of query, in order. Pairs that fail to unescape are skipped; err is
+// the first such failure.
+func parseQuery(query []byte, add func(key string, value []byte)) (err error) {
+	for {
+		key, value, rest, ok := cutQueryPair(query)
+		if !ok {
+			return err
 		}
+		query = rest
 		key, err1 := QueryUnescape(key)
 		if err1 != nil {
 			if err == nil {
@@ -83,10 +97,32 @@ func parseQuery(m Values, query []byte) (err error) {
 			}
 			continue
 		}
-		indexKey := string(key)
-		m[indexKey] = append(m[indexKey], value)
+		add(string(key), value)
+	}
+}
+
+// cutQueryPair cuts the first non-empty key=value pair off query,
+// still escaped, and returns the remaining query in rest. Pairs are
+// separated by '&' or ';', and a pair without '=' has an empty value.
+// ok is false if query holds no more pairs.
+func cutQueryPair(query []byte) (key, value, rest []byte, ok bool) {
+	for len(query) > 0 {
+		key = query
+		if i := bytes.IndexAny(key, "&;"); i >= 0 {
+			key, query = key[:i], key[i+1:]
+		} else {
+			query = EmptyByte
+		}
+		if len(key) == 0 {
+			continue
+		}
+		value = EmptyByte
+		if i := bytes.IndexByte(key, '='); i >= 0 {
+			key, value = key[:i], key[i+1:]
+		}
+		return key, value, query, true
 	}
-	return err
+	return nil, nil, query, false
 }
 
 // Encode encodes the values into ``URL encoded'' form
@@ -95,22 +131,39 @@ func (v Values) Encode() string {
 	if v == nil {
 		return ""
 	}
-	var buf bytes.Buffer
 	keys := make([]string, 0, len(v))
 	for k := range v {
 		keys = append(keys, k)
 	}
 	sort.Strings(keys)
+	buf := make([]byte, 0, v.EncodedLen())
 	for _, k := range keys {
-		vs := v[k]
-		prefix := append(QueryEscape([]byte(k)), EqualByte...)
-		for _, v := range vs {
-			if buf.Len() > 0 {
-				buf.WriteByte('&')
+		for _, value := range v[k] {
+			if len(buf) > 0 {
+				buf = append(buf, '&')
 			}
-			buf.Write(prefix)
-			buf.Write(QueryEscape(v))
+			buf = appendEscape(buf, []byte(k), EncodeQueryComponent)
+			buf = append(buf, '=')
+			buf = appendEscape(buf, value, EncodeQueryComponent)
+		}
+	}
+	return string(buf)
+}
+
+// EncodedLen returns the length of v.Encode(), without building it.
+func (v Values) EncodedLen() int {
+	n := 0
+	for k, vs := range v {
+		if len(vs) == 0 {
+			continue
 		}
+		keyLen := EscapedLen([]byte(k), EncodeQueryComponent)
+		for _, value := range vs {
+			n += keyLen + 1 + EscapedLen(value, EncodeQueryComponent) + 1
+		}
+	}
+	if n > 0 {
+		n-- // no '&' before the first pair
 	}
-	return buf.String()
+	return n
 }
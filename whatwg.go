@@ -0,0 +1,1023 @@
+package bytesurl
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+)
+
+// ErrInvalidHost is returned by ParseWHATWG for hosts the WHATWG host
+// parser rejects, such as hosts containing forbidden code points or
+// malformed IPv4 addresses.
+var ErrInvalidHost = errors.New("invalid host")
+
+// WHATWG URL Standard basic URL parser states.
+// See https://url.spec.whatwg.org/#concept-basic-url-parser.
+const (
+	stateSchemeStart = iota
+	stateScheme
+	stateNoScheme
+	stateSpecialRelativeOrAuthority
+	statePathOrAuthority
+	stateRelative
+	stateRelativeSlash
+	stateSpecialAuthoritySlashes
+	stateSpecialAuthorityIgnoreSlashes
+	stateAuthority
+	stateHost
+	statePort
+	stateFile
+	stateFileSlash
+	stateFileHost
+	statePathStart
+	statePath
+	stateOpaquePath
+	stateQuery
+	stateFragment
+)
+
+// eof stands for the EOF code point of the WHATWG parser.
+const eof = -1
+
+// specialPorts maps the WHATWG special schemes to their default port;
+// file has no default port.
+var specialPorts = map[string]int{
+	"ftp":   21,
+	"file":  -1,
+	"http":  80,
+	"https": 443,
+	"ws":    80,
+	"wss":   443,
+}
+
+// whatwgURL is a URL record as defined by the WHATWG URL Standard.
+// Components other than the host are kept percent-encoded.
+type whatwgURL struct {
+	scheme   []byte
+	username []byte
+	password []byte
+	host     []byte // serialized host; nil is the null host
+	port     int    // -1 is the null port
+	path     [][]byte
+	opaque   []byte // opaque path, valid when hasOpaquePath
+	query    []byte // nil is the null query
+	fragment []byte // nil is the null fragment
+
+	hasOpaquePath bool
+}
+
+func (u *whatwgURL) special() bool {
+	_, ok := specialPorts[string(u.scheme)]
+	return ok
+}
+
+// shortenPath removes the last path segment, except for a lone
+// normalized Windows drive letter of a file URL.
+func (u *whatwgURL) shortenPath() {
+	if bytes.Equal(u.scheme, []byte("file")) && len(u.path) == 1 && isNormalizedWindowsDriveLetter(u.path[0]) {
+		return
+	}
+	if len(u.path) > 0 {
+		u.path = u.path[:len(u.path)-1]
+	}
+}
+
+// ParseWHATWG parses input the way browsers do, following the basic
+// URL parser of the WHATWG URL Standard rather than RFC 3986. input is
+// resolved against base, which may be nil; base itself is parsed with
+// the same rules and must be absolute.
+//
+// Compared to Parse, ParseWHATWG strips leading and trailing C0
+// control or space and all tabs and newlines, treats '\' like '/' for
+// special schemes (ftp, file, http, https, ws and wss), lowercases and
+// validates hosts, normalizes IPv4 and IPv6 addresses, drops default
+// ports, removes dot segments and percent-encodes characters the
+// standard does not allow in each component. As the standard does, it
+// tells an empty host from no host and an empty fragment from none:
+// "foo://" and "http://a/#" keep their "//" and '#', through
+// URL.ForceHost and URL.ForceFragment.
+//
+// Domains are converted with ToASCII, which lower-cases them and
+// Punycode-encodes non-ASCII labels but does not apply the UTS #46
+// mapping the standard requires: code points that browsers map, such
+// as full-width letters, or reject are encoded as they are.
+func ParseWHATWG(input, base []byte) (*URL, error) {
+	var b *whatwgURL
+	if base != nil {
+		var err error
+		if b, err = parseWHATWG(base, nil); err != nil {
+			return nil, whatwgError(base, err)
+		}
+	}
+	u, err := parseWHATWG(input, b)
+	if err != nil {
+		return nil, whatwgError(input, err)
+	}
+	return u.toURL(), nil
+}
+
+// whatwgError completes err, located in input after the removal of
+// leading and trailing C0 control or space and of tabs and newlines,
+// and moves its offset back to the corresponding byte of input.
+func whatwgError(input []byte, err error) error {
+	e := err.(*Error)
+	i := 0
+	for i < len(input) && input[i] <= ' ' {
+		i++
+	}
+	for n := 0; i < len(input); i++ {
+		if c := input[i]; c == '\t' || c == '\n' || c == '\r' {
+			continue
+		}
+		if n == e.Offset {
+			break
+		}
+		n++
+	}
+	e.Offset = i
+	return parseError(input, e)
+}
+
+// parseWHATWG runs the basic URL parser on input without a state override.
+// Errors are located in input as cleaned up by the parser, see whatwgError.
+func parseWHATWG(input []byte, base *whatwgURL) (*whatwgURL, error) {
+	input = trimControlAndSpace(input)
+	input = removeTabAndNewline(input)
+
+	url := &whatwgURL{port: -1}
+	state := stateSchemeStart
+	var buffer []byte
+	var atSignSeen, insideBrackets, passwordTokenSeen bool
+
+	for pointer := 0; ; pointer++ {
+		c := eof
+		if pointer < len(input) {
+			c = int(input[pointer])
+		}
+		remaining := EmptyByte
+		if pointer+1 < len(input) {
+			remaining = input[pointer+1:]
+		}
+
+		switch state {
+		case stateSchemeStart:
+			if isASCIIAlpha(c) {
+				buffer = append(buffer, lowerByte(byte(c)))
+				state = stateScheme
+			} else {
+				state = stateNoScheme
+				pointer--
+			}
+
+		case stateScheme:
+			switch {
+			case isASCIIAlpha(c) || isASCIIDigit(c) || c == '+' || c == '-' || c == '.':
+				buffer = append(buffer, lowerByte(byte(c)))
+			case c == ':':
+				url.scheme, buffer = buffer, nil
+				switch {
+				case string(url.scheme) == "file":
+					state = stateFile
+				case url.special() && base != nil && bytes.Equal(base.scheme, url.scheme):
+					state = stateSpecialRelativeOrAuthority
+				case url.special():
+					state = stateSpecialAuthoritySlashes
+				case len(remaining) > 0 && remaining[0] == '/':
+					state = statePathOrAuthority
+					pointer++
+				default:
+					url.opaque, url.hasOpaquePath = []byte{}, true
+					state = stateOpaquePath
+				}
+			default:
+				buffer = nil
+				state = stateNoScheme
+				pointer = -1
+			}
+
+		case stateNoScheme:
+			switch {
+			case base == nil || base.hasOpaquePath && c != '#':
+				return nil, errorAt(ComponentScheme, 0, ErrProtocolScheme)
+			case base.hasOpaquePath && c == '#':
+				url.scheme = base.scheme
+				url.opaque, url.hasOpaquePath = base.opaque, true
+				url.query = base.query
+				url.fragment = []byte{}
+				state = stateFragment
+			case string(base.scheme) != "file":
+				state = stateRelative
+				pointer--
+			default:
+				state = stateFile
+				pointer--
+			}
+
+		case stateSpecialRelativeOrAuthority:
+			if c == '/' && len(remaining) > 0 && remaining[0] == '/' {
+				state = stateSpecialAuthorityIgnoreSlashes
+				pointer++
+			} else {
+				state = stateRelative
+				pointer--
+			}
+
+		case statePathOrAuthority:
+			if c == '/' {
+				state = stateAuthority
+			} else {
+				state = statePath
+				pointer--
+			}
+
+		case stateRelative:
+			url.scheme = base.scheme
+			if c == '/' || url.special() && c == '\\' {
+				state = stateRelativeSlash
+				break
+			}
+			url.username, url.password = base.username, base.password
+			url.host, url.port = base.host, base.port
+			url.path = clonePath(base.path)
+			url.query = base.query
+			switch {
+			case c == '?':
+				url.query = []byte{}
+				state = stateQuery
+			case c == '#':
+				url.fragment = []byte{}
+				state = stateFragment
+			case c != eof:
+				url.query = nil
+				url.shortenPath()
+				state = statePath
+				pointer--
+			}
+
+		case stateRelativeSlash:
+			switch {
+			case url.special() && (c == '/' || c == '\\'):
+				state = stateSpecialAuthorityIgnoreSlashes
+			case c == '/':
+				state = stateAuthority
+			default:
+				url.username, url.password = base.username, base.password
+				url.host, url.port = base.host, base.port
+				state = statePath
+				pointer--
+			}
+
+		case stateSpecialAuthoritySlashes:
+			if c == '/' && len(remaining) > 0 && remaining[0] == '/' {
+				pointer++
+			} else {
+				pointer--
+			}
+			state = stateSpecialAuthorityIgnoreSlashes
+
+		case stateSpecialAuthorityIgnoreSlashes:
+			if c != '/' && c != '\\' {
+				state = stateAuthority
+				pointer--
+			}
+
+		case stateAuthority:
+			switch {
+			case c == '@':
+				if atSignSeen {
+					buffer = append([]byte("%40"), buffer...)
+				}
+				atSignSeen = true
+				for _, b := range buffer {
+					if b == ':' && !passwordTokenSeen {
+						passwordTokenSeen = true
+						continue
+					}
+					if passwordTokenSeen {
+						url.password = appendPercentEncoded(url.password, b, &WHATWGUserinfo)
+					} else {
+						url.username = appendPercentEncoded(url.username, b, &WHATWGUserinfo)
+					}
+				}
+				buffer = nil
+			case c == eof || c == '/' || c == '?' || c == '#' || url.special() && c == '\\':
+				if atSignSeen && len(buffer) == 0 {
+					return nil, errorAt(ComponentHost, pointer, ErrInvalidHost)
+				}
+				pointer -= len(buffer) + 1
+				buffer = nil
+				state = stateHost
+			default:
+				buffer = append(buffer, byte(c))
+			}
+
+		case stateHost:
+			switch {
+			case c == ':' && !insideBrackets:
+				if len(buffer) == 0 {
+					return nil, errorAt(ComponentHost, pointer, ErrInvalidHost)
+				}
+				host, err := parseWHATWGHost(buffer, !url.special())
+				if err != nil {
+					return nil, errorAt(ComponentHost, pointer-len(buffer), err)
+				}
+				url.host, buffer = host, nil
+				state = statePort
+			case c == eof || c == '/' || c == '?' || c == '#' || url.special() && c == '\\':
+				if url.special() && len(buffer) == 0 {
+					return nil, errorAt(ComponentHost, pointer, ErrInvalidHost)
+				}
+				host, err := parseWHATWGHost(buffer, !url.special())
+				if err != nil {
+					return nil, errorAt(ComponentHost, pointer-len(buffer), err)
+				}
+				pointer--
+				url.host, buffer = host, nil
+				state = statePathStart
+			default:
+				if c == '[' {
+					insideBrackets = true
+				} else if c == ']' {
+					insideBrackets = false
+				}
+				buffer = append(buffer, byte(c))
+			}
+
+		case statePort:
+			switch {
+			case isASCIIDigit(c):
+				buffer = append(buffer, byte(c))
+			case c == eof || c == '/' || c == '?' || c == '#' || url.special() && c == '\\':
+				if len(buffer) > 0 {
+					port := 0
+					for i, d := range buffer {
+						port = port*10 + int(d-'0')
+						if port > 65535 {
+							return nil, errorAt(ComponentPort, pointer-len(buffer)+i, ErrInvalidPort)
+						}
+					}
+					if port == specialPorts[string(url.scheme)] && url.special() {
+						port = -1
+					}
+					url.port, buffer = port, nil
+				}
+				state = statePathStart
+				pointer--
+			default:
+				return nil, errorAt(ComponentPort, pointer, ErrInvalidPort)
+			}
+
+		case stateFile:
+			url.scheme = []byte("file")
+			url.host = []byte{}
+			if c == '/' || c == '\\' {
+				state = stateFileSlash
+				break
+			}
+			if base == nil || string(base.scheme) != "file" {
+				state = statePath
+				pointer--
+				break
+			}
+			url.host = base.host
+			url.path = clonePath(base.path)
+			url.query = base.query
+			switch {
+			case c == '?':
+				url.query = []byte{}
+				state = stateQuery
+			case c == '#':
+				url.fragment = []byte{}
+				state = stateFragment
+			case c != eof:
+				url.query = nil
+				if !startsWithWindowsDriveLetter(input[pointer:]) {
+					url.shortenPath()
+				} else {
+					url.path = nil
+				}
+				state = statePath
+				pointer--
+			}
+
+		case stateFileSlash:
+			if c == '/' || c == '\\' {
+				state = stateFileHost
+				break
+			}
+			if base != nil && string(base.scheme) == "file" {
+				url.host = base.host
+				if !startsWithWindowsDriveLetter(input[pointer:]) &&
+					len(base.path) > 0 && isNormalizedWindowsDriveLetter(base.path[0]) {
+					url.path = append(url.path, base.path[0])
+				}
+			}
+			state = statePath
+			pointer--
+
+		case stateFileHost:
+			if c != eof && c != '/' && c != '\\' && c != '?' && c != '#' {
+				buffer = append(buffer, byte(c))
+				break
+			}
+			switch {
+			case isWindowsDriveLetter(buffer):
+				// The buffer is reused as the first path segment.
+				state = statePath
+				pointer--
+			case len(buffer) == 0:
+				url.host = []byte{}
+				state = statePathStart
+				pointer--
+			default:
+				host, err := parseWHATWGHost(buffer, !url.special())
+				if err != nil {
+					return nil, errorAt(ComponentHost, pointer-len(buffer), err)
+				}
+				if string(host) == "localhost" {
+					host = []byte{}
+				}
+				url.host, buffer = host, nil
+				state = statePathStart
+				pointer--
+			}
+
+		case statePathStart:
+			switch {
+			case url.special():
+				state = statePath
+				if c != '/' && c != '\\' {
+					pointer--
+				}
+			case c == '?':
+				url.query = []byte{}
+				state = stateQuery
+			case c == '#':
+				url.fragment = []byte{}
+				state = stateFragment
+			case c != eof:
+				state = statePath
+				if c != '/' {
+					pointer--
+				}
+			}
+
+		case statePath:
+			slash := c == '/' || url.special() && c == '\\'
+			if c != eof && !slash && c != '?' && c != '#' {
+				buffer = appendPercentEncoded(buffer, byte(c), &WHATWGPath)
+				break
+			}
+			switch {
+			case isDoubleDotSegment(buffer):
+				url.shortenPath()
+				if !slash {
+					url.path = append(url.path, []byte{})
+				}
+			case isSingleDotSegment(buffer):
+				if !slash {
+					url.path = append(url.path, []byte{})
+				}
+			default:
+				if string(url.scheme) == "file" && len(url.path) == 0 && isWindowsDriveLetter(buffer) {
+					buffer[1] = ':'
+				}
+				url.path = append(url.path, buffer)
+			}
+			buffer = nil
+			if c == '?' {
+				url.query = []byte{}
+				state = stateQuery
+			} else if c == '#' {
+				url.fragment = []byte{}
+				state = stateFragment
+			}
+
+		case stateOpaquePath:
+			switch {
+			case c == '?':
+				url.query = []byte{}
+				state = stateQuery
+			case c == '#':
+				url.fragment = []byte{}
+				state = stateFragment
+			case c != eof:
+				url.opaque = appendPercentEncoded(url.opaque, byte(c), &WHATWGC0Control)
+			}
+
+		case stateQuery:
+			if c != eof && c != '#' {
+				buffer = append(buffer, byte(c))
+				break
+			}
+			set := &WHATWGQuery
+			if url.special() {
+				set = &WHATWGSpecialQuery
+			}
+			for _, b := range buffer {
+				url.query = appendPercentEncoded(url.query, b, set)
+			}
+			buffer = nil
+			if c == '#' {
+				url.fragment = []byte{}
+				state = stateFragment
+			}
+
+		case stateFragment:
+			if c != eof {
+				url.fragment = appendPercentEncoded(url.fragment, byte(c), &WHATWGFragment)
+			}
+		}
+
+		if pointer >= len(input) {
+			break
+		}
+	}
+	return url, nil
+}
+
+// toURL converts the URL record into a URL. Percent-encoded components
+// are decoded into the corresponding fields, keeping the encoded form
+// in RawPath and RawFragment where it differs from the default one.
+func (u *whatwgURL) toURL() *URL {
+	url := &URL{Scheme: u.scheme}
+	if len(u.username) > 0 || len(u.password) > 0 {
+		username := unescapeOrRaw(u.username, EncodeUserPassword)
+		if len(u.password) > 0 {
+			url.User = UserPassword(username, unescapeOrRaw(u.password, EncodeUserPassword))
+		} else {
+			url.User = User(username)
+		}
+	}
+	if u.host != nil {
+		url.Host = u.host
+		if u.port >= 0 {
+			url.Host = append(append(append([]byte{}, u.host...), ':'), strconv.Itoa(u.port)...)
+		}
+		if bytes.IndexByte(url.Host, '%') >= 0 {
+			// Only opaque hosts keep percent-encoding. Decode them
+			// like paths, keeping the encoded form in RawHost.
+			url.RawHost = url.Host
+			url.Host, _ = unescapeLenient(url.Host, EncodeHost)
+		}
+	}
+	if u.hasOpaquePath {
+		url.Opaque = u.opaque
+	} else {
+		url.OmitHost = u.host == nil
+		url.ForceHost = u.host != nil && len(u.host) == 0
+		var path []byte
+		if u.host == nil && len(u.path) > 1 && len(u.path[0]) == 0 {
+			// Keep "//" at the start of the path from being
+			// mistaken for an authority.
+			path = append(path, '/', '.')
+		}
+		for _, seg := range u.path {
+			path = append(path, '/')
+			path = append(path, seg...)
+		}
+		if err := url.setPath(path, nil); err != nil {
+			url.Path, url.RawPath = path, path
+		}
+	}
+	url.RawQuery = u.query
+	url.ForceQuery = u.query != nil && len(u.query) == 0
+	url.ForceFragment = u.fragment != nil && len(u.fragment) == 0
+	if u.fragment != nil {
+		if err := url.setFragment(u.fragment, nil); err != nil {
+			url.Fragment, url.RawFragment = u.fragment, u.fragment
+		}
+	}
+	return url
+}
+
+// unescapeOrRaw unescapes s, falling back to s itself when it
+// contains a '%' that does not start a valid escape.
+func unescapeOrRaw(s []byte, mode Encoding) []byte {
+	if t, err := unescape(s, mode); err == nil {
+		return t
+	}
+	return s
+}
+
+// parseWHATWGHost implements the WHATWG host parser.
+func parseWHATWGHost(input []byte, isOpaque bool) ([]byte, error) {
+	if len(input) > 0 && input[0] == '[' {
+		if input[len(input)-1] != ']' {
+			return nil, ErrInvalidIPLiteral
+		}
+		var addr [8]uint16
+		if !parseWHATWGIPv6(input[1:len(input)-1], &addr) {
+			return nil, ErrInvalidIPLiteral
+		}
+		return serializeIPv6(addr), nil
+	}
+	if isOpaque {
+		for _, c := range input {
+			if c != '%' && isForbiddenHostCodePoint(c) {
+				return nil, ErrInvalidHost
+			}
+		}
+		// An empty opaque host, as in "foo:///a", is still a host,
+		// unlike the null host of "foo:/a", so it must not be nil.
+		host := make([]byte, 0, len(input))
+		for _, c := range input {
+			host = appendPercentEncoded(host, c, &WHATWGC0Control)
+		}
+		return host, nil
+	}
+	domain := percentDecodeLenient(input)
+	asciiDomain, err := ToASCII(domain)
+	if err != nil || len(asciiDomain) == 0 {
+		return nil, ErrInvalidHost
+	}
+	for _, c := range asciiDomain {
+		if isForbiddenDomainCodePoint(c) {
+			return nil, ErrInvalidHost
+		}
+	}
+	if endsInANumber(asciiDomain) {
+		ipv4, ok := parseWHATWGIPv4(asciiDomain)
+		if !ok {
+			return nil, ErrInvalidHost
+		}
+		return serializeIPv4(ipv4), nil
+	}
+	return asciiDomain, nil
+}
+
+// endsInANumber reports whether the last label of input is numeric,
+// which makes the host an IPv4 address.
+func endsInANumber(input []byte) bool {
+	parts := bytes.Split(input, DotByte)
+	if len(parts[len(parts)-1]) == 0 {
+		if len(parts) == 1 {
+			return false
+		}
+		parts = parts[:len(parts)-1]
+	}
+	last := parts[len(parts)-1]
+	if len(last) > 0 {
+		digits := true
+		for _, c := range last {
+			if !isASCIIDigit(int(c)) {
+				digits = false
+				break
+			}
+		}
+		if digits {
+			return true
+		}
+	}
+	_, ok := parseIPv4Number(last)
+	return ok
+}
+
+// parseWHATWGIPv4 implements the IPv4 parser, which accepts one to
+// four dot-separated parts in decimal, octal or hexadecimal.
+func parseWHATWGIPv4(input []byte) (uint32, bool) {
+	parts := bytes.Split(input, DotByte)
+	if len(parts[len(parts)-1]) == 0 && len(parts) > 1 {
+		parts = parts[:len(parts)-1]
+	}
+	if len(parts) > 4 {
+		return 0, false
+	}
+	var numbers [4]uint64
+	for i, part := range parts {
+		n, ok := parseIPv4Number(part)
+		if !ok {
+			return 0, false
+		}
+		numbers[i] = n
+	}
+	last := len(parts) - 1
+	for _, n := range numbers[:last] {
+		if n > 255 {
+			return 0, false
+		}
+	}
+	if numbers[last] >= 1<<(8*uint(5-len(parts))) {
+		return 0, false
+	}
+	ipv4 := numbers[last]
+	for i, n := range numbers[:last] {
+		ipv4 += n << (8 * uint(3-i))
+	}
+	return uint32(ipv4), true
+}
+
+// parseIPv4Number parses a single IPv4 part.
+func parseIPv4Number(input []byte) (uint64, bool) {
+	if len(input) == 0 {
+		return 0, false
+	}
+	radix := uint64(10)
+	if len(input) >= 2 && input[0] == '0' && (input[1] == 'x' || input[1] == 'X') {
+		input, radix = input[2:], 16
+	} else if len(input) >= 2 && input[0] == '0' {
+		input, radix = input[1:], 8
+	}
+	var n uint64
+	for _, c := range input {
+		var d uint64
+		switch {
+		case '0' <= c && c <= '9':
+			d = uint64(c - '0')
+		case radix == 16 && ishex(c):
+			d = uint64(unhex(c))
+		default:
+			return 0, false
+		}
+		if d >= radix {
+			return 0, false
+		}
+		n = n*radix + d
+		if n > 1<<32 {
+			// Too large for any part; keep scanning for
+			// invalid digits but avoid overflow.
+			n = 1 << 32
+		}
+	}
+	return n, true
+}
+
+func serializeIPv4(addr uint32) []byte {
+	b := make([]byte, 0, len("255.255.255.255"))
+	for i := 3; i >= 0; i-- {
+		b = strconv.AppendUint(b, uint64(addr>>(8*uint(i))&0xff), 10)
+		if i > 0 {
+			b = append(b, '.')
+		}
+	}
+	return b
+}
+
+// parseWHATWGIPv6 implements the IPv6 parser, filling addr.
+func parseWHATWGIPv6(input []byte, addr *[8]uint16) bool {
+	pieceIndex, compress := 0, -1
+	pointer := 0
+	at := func(i int) int {
+		if i < len(input) {
+			return int(input[i])
+		}
+		return eof
+	}
+	if at(0) == ':' {
+		if at(1) != ':' {
+			return false
+		}
+		pointer += 2
+		pieceIndex++
+		compress = pieceIndex
+	}
+	for at(pointer) != eof {
+		if pieceIndex == 8 {
+			return false
+		}
+		if at(pointer) == ':' {
+			if compress >= 0 {
+				return false
+			}
+			pointer++
+			pieceIndex++
+			compress = pieceIndex
+			continue
+		}
+		value, length := 0, 0
+		for length < 4 && at(pointer) != eof && ishex(input[pointer]) {
+			value = value*0x10 + int(unhex(input[pointer]))
+			pointer++
+			length++
+		}
+		if at(pointer) == '.' {
+			if length == 0 {
+				return false
+			}
+			pointer -= length
+			if pieceIndex > 6 {
+				return false
+			}
+			numbersSeen := 0
+			for at(pointer) != eof {
+				ipv4Piece := -1
+				if numbersSeen > 0 {
+					if at(pointer) == '.' && numbersSeen < 4 {
+						pointer++
+					} else {
+						return false
+					}
+				}
+				if !isASCIIDigit(at(pointer)) {
+					return false
+				}
+				for isASCIIDigit(at(pointer)) {
+					number := at(pointer) - '0'
+					if ipv4Piece == -1 {
+						ipv4Piece = number
+					} else if ipv4Piece == 0 {
+						return false
+					} else {
+						ipv4Piece = ipv4Piece*10 + number
+					}
+					if ipv4Piece > 255 {
+						return false
+					}
+					pointer++
+				}
+				addr[pieceIndex] = addr[pieceIndex]*0x100 + uint16(ipv4Piece)
+				numbersSeen++
+				if numbersSeen == 2 || numbersSeen == 4 {
+					pieceIndex++
+				}
+			}
+			if numbersSeen != 4 {
+				return false
+			}
+			break
+		} else if at(pointer) == ':' {
+			pointer++
+			if at(pointer) == eof {
+				return false
+			}
+		} else if at(pointer) != eof {
+			return false
+		}
+		addr[pieceIndex] = uint16(value)
+		pieceIndex++
+	}
+	if compress >= 0 {
+		swaps := pieceIndex - compress
+		pieceIndex = 7
+		for pieceIndex != 0 && swaps > 0 {
+			addr[pieceIndex], addr[compress+swaps-1] = addr[compress+swaps-1], addr[pieceIndex]
+			pieceIndex--
+			swaps--
+		}
+	} else if pieceIndex != 8 {
+		return false
+	}
+	return true
+}
+
+// serializeIPv6 writes addr in bracketed, compressed form, eliding the
+// first longest run of two or more zero pieces.
+func serializeIPv6(addr [8]uint16) []byte {
+	compress, longest := -1, 1
+	for i := 0; i < 8; {
+		j := i
+		for j < 8 && addr[j] == 0 {
+			j++
+		}
+		if j-i > longest {
+			compress, longest = i, j-i
+		}
+		if j == i {
+			j++
+		}
+		i = j
+	}
+	b := make([]byte, 0, len("[ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff]"))
+	b = append(b, '[')
+	ignore0 := false
+	for i := 0; i < 8; i++ {
+		if ignore0 && addr[i] == 0 {
+			continue
+		}
+		ignore0 = false
+		if i == compress {
+			if i == 0 {
+				b = append(b, "::"...)
+			} else {
+				b = append(b, ':')
+			}
+			ignore0 = true
+			continue
+		}
+		b = strconv.AppendUint(b, uint64(addr[i]), 16)
+		if i != 7 {
+			b = append(b, ':')
+		}
+	}
+	return append(b, ']')
+}
+
+// percentDecodeLenient decodes valid %XX sequences, leaving any other
+// '%' in place.
+func percentDecodeLenient(s []byte) []byte {
+	if bytes.IndexByte(s, '%') < 0 {
+		return s
+	}
+	t := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && ishex(s[i+1]) && ishex(s[i+2]) {
+			t = append(t, unhex(s[i+1])<<4|unhex(s[i+2]))
+			i += 2
+			continue
+		}
+		t = append(t, s[i])
+	}
+	return t
+}
+
+// appendPercentEncoded appends c to dst, percent-encoded if it is in set.
+func appendPercentEncoded(dst []byte, c byte, set *EncodeSet) []byte {
+	if set.Contains(c) {
+		return append(dst, '%', "0123456789ABCDEF"[c>>4], "0123456789ABCDEF"[c&15])
+	}
+	return append(dst, c)
+}
+
+func isForbiddenHostCodePoint(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\r', ' ', '#', '/', ':', '<', '>', '?', '@', '[', '\\', ']', '^', '|':
+		return true
+	}
+	return false
+}
+
+func isForbiddenDomainCodePoint(c byte) bool {
+	return isForbiddenHostCodePoint(c) || c < 0x20 || c == '%' || c == 0x7f
+}
+
+func isSingleDotSegment(s []byte) bool {
+	return bytes.Equal(s, DotByte) || bytes.EqualFold(s, []byte("%2e"))
+}
+
+func isDoubleDotSegment(s []byte) bool {
+	switch len(s) {
+	case 2:
+		return bytes.Equal(s, DoubleDotByte)
+	case 4:
+		return bytes.EqualFold(s, []byte(".%2e")) || bytes.EqualFold(s, []byte("%2e."))
+	case 6:
+		return bytes.EqualFold(s, []byte("%2e%2e"))
+	}
+	return false
+}
+
+func isWindowsDriveLetter(s []byte) bool {
+	return len(s) == 2 && isASCIIAlpha(int(s[0])) && (s[1] == ':' || s[1] == '|')
+}
+
+func isNormalizedWindowsDriveLetter(s []byte) bool {
+	return isWindowsDriveLetter(s) && s[1] == ':'
+}
+
+func startsWithWindowsDriveLetter(s []byte) bool {
+	if len(s) < 2 || !isWindowsDriveLetter(s[:2]) {
+		return false
+	}
+	if len(s) == 2 {
+		return true
+	}
+	switch s[2] {
+	case '/', '\\', '?', '#':
+		return true
+	}
+	return false
+}
+
+func clonePath(path [][]byte) [][]byte {
+	return append([][]byte(nil), path...)
+}
+
+// trimControlAndSpace strips leading and trailing C0 control or space.
+func trimControlAndSpace(s []byte) []byte {
+	for len(s) > 0 && s[0] <= ' ' {
+		s = s[1:]
+	}
+	for len(s) > 0 && s[len(s)-1] <= ' ' {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// removeTabAndNewline removes all ASCII tab or newline from s.
+func removeTabAndNewline(s []byte) []byte {
+	if bytes.IndexAny(s, "\t\n\r") < 0 {
+		return s
+	}
+	t := make([]byte, 0, len(s))
+	for _, c := range s {
+		if c != '\t' && c != '\n' && c != '\r' {
+			t = append(t, c)
+		}
+	}
+	return t
+}
+
+func isASCIIAlpha(c int) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isASCIIDigit(c int) bool {
+	return '0' <= c && c <= '9'
+}
+
+func lowerByte(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}